@@ -0,0 +1,71 @@
+package main
+
+import (
+	"car-status-backend/internal/mlfake"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// fakeml runs the stand-in ML service for local development and end-to-end
+// testing without the Python service and its model files.
+func main() {
+	addr := flag.String("addr", ":8000", "address to listen on")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve the gRPC MLService on, if set")
+	scriptPath := flag.String("script", "", "JSON script with default, rules, queue and failure_rate")
+	latency := flag.Duration("latency", 0, "delay of every default response")
+	failureRate := flag.Float64("failure-rate", 0, "fraction (0..1) of requests answered with 503")
+	modelVersion := flag.String("model-version", "", "model version of default responses")
+	checkFiles := flag.Bool("check-files", false, "answer 404 for image paths that do not exist")
+	flag.Parse()
+
+	var script mlfake.Script
+	if *scriptPath != "" {
+		var err error
+		script, err = mlfake.LoadScript(*scriptPath)
+		if err != nil {
+			log.Fatalf("Failed to load script: %v", err)
+		}
+	}
+
+	if *latency > 0 {
+		script.Default.Delay = mlfake.Duration(*latency)
+	}
+	if *failureRate > 0 {
+		script.FailureRate = *failureRate
+	}
+	if *modelVersion != "" {
+		script.Default.ModelVersion = *modelVersion
+	}
+	if *checkFiles {
+		script.CheckFiles = true
+	}
+
+	fake := mlfake.NewServer(script)
+
+	if *grpcAddr != "" {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", *grpcAddr, err)
+		}
+		go func() {
+			log.Printf("Fake ML gRPC service listening on %s", *grpcAddr)
+			if err := fake.GRPCServer().Serve(listener); err != nil {
+				log.Fatalf("Fake ML gRPC service failed: %v", err)
+			}
+		}()
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           fake,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Fake ML service listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("Fake ML service failed: %v", err)
+	}
+}
@@ -5,8 +5,14 @@ import (
 	"car-status-backend/internal/database"
 	"car-status-backend/internal/server"
 	"car-status-backend/internal/services"
+	"car-status-backend/internal/worker"
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -38,45 +44,150 @@ func main() {
 
 	predictionService := services.NewPredictionService(db)
 
+	var cassette *services.MLCassette
+	if cfg.MLService.CassetteMode != "" && cfg.MLService.CassetteMode != services.CassetteOff {
+		cassette, err = services.NewMLCassette(cfg.MLService.CassetteMode, cfg.MLService.CassettePath)
+		if err != nil {
+			log.Fatalf("Failed to open ML cassette: %v", err)
+		}
+		defer cassette.Close()
+		log.Printf("ML cassette %s mode: %s", cassette.Mode(), cfg.MLService.CassettePath)
+	}
+
 	mlClient := services.NewMLClient(
-		cfg.MLService.BaseURL,
+		cfg.MLService.Endpoints,
 		cfg.MLService.Timeout,
 		cfg.MLService.APIKey,
+		cfg.MLService.Transport,
+		cfg.MLService.MaxRetries,
+		services.RetryPolicy{
+			BaseDelay: cfg.MLService.RetryBaseDelay,
+			MaxDelay:  cfg.MLService.RetryMaxDelay,
+			Jitter:    0.5,
+		},
+		services.HedgePolicy{
+			Percentile: cfg.MLService.HedgePercentile,
+			MinDelay:   cfg.MLService.HedgeMinDelay,
+			MaxDelay:   cfg.MLService.HedgeMaxDelay,
+		},
+		cfg.MLService.BreakerThreshold,
+		cfg.MLService.BreakerOpenTimeout,
+		cassette,
 	)
+	defer mlClient.Close()
+	log.Printf("ML service transport: %s", cfg.MLService.Transport)
+	if mlClient.HedgingEnabled() {
+		log.Printf("Hedging ML requests slower than p%v (%s..%s) to replicas",
+			cfg.MLService.HedgePercentile, cfg.MLService.HedgeMinDelay, cfg.MLService.HedgeMaxDelay)
+	}
 
-	var queueService *services.QueueService
-	if cfg.Queue.Enabled {
-		queueService = services.NewQueueService(
-			cfg.Queue.Type,
-			cfg.Queue.URL,
-			cfg.Queue.QueueName,
+	// shadowService stays nil unless candidate models are configured. Shadow
+	// calls are never retried: a lost shadow prediction costs nothing.
+	var shadowService *services.ShadowService
+	if len(cfg.MLService.ShadowEndpoints) > 0 {
+		shadowClient := services.NewMLClient(
+			cfg.MLService.ShadowEndpoints,
+			cfg.MLService.Timeout,
+			cfg.MLService.APIKey,
+			cfg.MLService.Transport,
+			0,
+			services.RetryPolicy{},
+			services.HedgePolicy{},
+			cfg.MLService.BreakerThreshold,
+			cfg.MLService.BreakerOpenTimeout,
+			nil,
+		)
+		defer shadowClient.Close()
+		shadowService = services.NewShadowService(
 			db,
+			shadowClient,
+			cfg.MLService.ShadowEndpoints,
+			cfg.MLService.ShadowConcurrency,
+			cfg.MLService.Timeout,
 		)
-		log.Printf("Queue service enabled: %s", cfg.Queue.Type)
+		defer shadowService.Close()
+		log.Printf("Shadow predictions enabled for %d candidate models", len(cfg.MLService.ShadowEndpoints))
+	}
+
+	// mlLimiter stays nil when ML_MAX_IN_FLIGHT is 0, leaving synchronous
+	// predictions unbounded.
+	var mlLimiter *services.MLLimiter
+	if cfg.MLService.MaxInFlight > 0 {
+		mlLimiter = services.NewMLLimiter(cfg.MLService.MaxInFlight, cfg.MLService.MaxQueued, cfg.MLService.QueueTimeout)
+		log.Printf("ML concurrency limit: %d in flight, %d queued for up to %s",
+			cfg.MLService.MaxInFlight, cfg.MLService.MaxQueued, cfg.MLService.QueueTimeout)
+	}
+
+	// queueService stays a nil interface when the queue is disabled, so the
+	// handlers fall back to calling the ML service directly.
+	var queueService services.Queue
+	if cfg.Queue.Enabled {
+		queueService, err = services.NewQueue(*cfg, db)
+		if err != nil {
+			log.Fatalf("Failed to initialize queue: %v", err)
+		}
+		defer queueService.Close()
+		log.Printf("Queue service enabled: %s", queueService.Type())
 	} else {
 		log.Println("Queue service disabled, using direct ML client calls")
 	}
 
+	var batchService *services.BatchService
+	if queueService != nil {
+		batchService = services.NewBatchService(db, queueService, cfg.Queue.BatchMaxSize)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var workerPool *worker.Pool
+	if queueService != nil && cfg.Worker.Enabled {
+		workerPool = worker.NewPool(
+			queueService,
+			imageService,
+			predictionService,
+			mlClient,
+			shadowService,
+			worker.Options{
+				PoolSize:      cfg.Worker.PoolSize,
+				PollInterval:  cfg.Worker.PollInterval,
+				LeaseDuration: cfg.Worker.LeaseDuration,
+				ReapInterval:  cfg.Worker.ReapInterval,
+			},
+		)
+		workerPool.Start(ctx)
+	}
+
 	handlers := server.NewHandlers(
 		imageService,
 		predictionService,
 		mlClient,
 		queueService,
+		batchService,
+		shadowService,
+		mlLimiter,
+		cfg.Storage.AutoPredict,
 		db,
 	)
 
-	srv := server.NewServer(cfg.Server.Host + ":" + cfg.Server.Port)
+	srv := server.NewServer(cfg.Server.Host+":"+cfg.Server.Port, cfg.Server.AdminAPIKey, cfg.Server.ClientAPIKeys)
 	srv.RegisterRoutes(handlers)
 
 	go srv.GracefulShutdown()
 
 	log.Printf("Car Status Backend starting on %s:%s", cfg.Server.Host, cfg.Server.Port)
 	log.Printf("Upload path: %s", cfg.Storage.UploadPath)
-	log.Printf("ML Service URL: %s", cfg.MLService.BaseURL)
+	for _, endpoint := range cfg.MLService.Endpoints {
+		log.Printf("ML endpoint %s: %s (model version %q, weight %d)", endpoint.Name, endpoint.URL, endpoint.ModelVersion, endpoint.Weight)
+	}
 	log.Printf("Max file size: %d bytes", cfg.Storage.MaxFileSize)
 	log.Printf("Allowed file types: %v", cfg.Storage.AllowedTypes)
 
-	if err := srv.Start(); err != nil {
+	if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+
+	if workerPool != nil {
+		workerPool.Wait()
+	}
 }
\ No newline at end of file
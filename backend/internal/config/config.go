@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -9,6 +10,16 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// MLEndpoint is one ML service deployment. Requests are split between
+// endpoints in proportion to Weight; for shadow endpoints Weight is the
+// percentage of images mirrored.
+type MLEndpoint struct {
+	Name         string
+	URL          string
+	ModelVersion string
+	Weight       int
+}
+
 type Config struct {
 	Server struct {
 		Host         string
@@ -16,6 +27,10 @@ type Config struct {
 		ReadTimeout  time.Duration
 		WriteTimeout time.Duration
 		IdleTimeout  time.Duration
+		AdminAPIKey  string
+		// ClientAPIKeys maps API keys to the client names that jobs are
+		// attributed to for fair scheduling.
+		ClientAPIKeys map[string]string
 	}
 	Database struct {
 		Host         string
@@ -28,20 +43,69 @@ type Config struct {
 		MaxIdleConns int
 	}
 	MLService struct {
-		BaseURL string
-		Timeout time.Duration
-		APIKey  string
+		BaseURL   string
+		Endpoints []MLEndpoint
+		Timeout   time.Duration
+		APIKey    string
+		Transport string
+
+		MaxRetries         int
+		RetryBaseDelay     time.Duration
+		RetryMaxDelay      time.Duration
+		BreakerThreshold   int
+		BreakerOpenTimeout time.Duration
+
+		// HedgePercentile (0 disables) hedges calls slower than that
+		// percentile of recent latencies, clamped to HedgeMinDelay and
+		// HedgeMaxDelay, to a replica with the same model version.
+		HedgePercentile float64
+		HedgeMinDelay   time.Duration
+		HedgeMaxDelay   time.Duration
+
+		// ShadowEndpoints receive a copy of Weight percent of the images
+		// in the background; their results are only stored for comparison.
+		ShadowEndpoints   []MLEndpoint
+		ShadowConcurrency int
+
+		// CassetteMode records ML calls to CassettePath ("record") or
+		// answers them from it without calling the service ("replay").
+		CassetteMode string
+		CassettePath string
+
+		// MaxInFlight bounds the synchronous ML calls made by the API (0
+		// disables the limit); up to MaxQueued more wait at most QueueTimeout
+		// for a slot before the request is shed.
+		MaxInFlight  int
+		MaxQueued    int
+		QueueTimeout time.Duration
 	}
 	Storage struct {
 		UploadPath   string
 		MaxFileSize  int64
 		AllowedTypes []string
+		AutoPredict  bool
 	}
 	Queue struct {
-		Enabled   bool
-		Type      string
-		URL       string
-		QueueName string
+		Enabled        bool
+		Type           string
+		URL            string
+		QueueName      string
+		MaxRetries     int
+		RetryBaseDelay time.Duration
+		RetryMaxDelay  time.Duration
+		RetryJitter    float64
+		BatchMaxSize   int
+		OutboxInterval time.Duration
+		// Partitions is the partition count of the Kafka topics created by
+		// the backend; 0 uses Worker.PoolSize.
+		Partitions int
+	}
+	Worker struct {
+		Enabled       bool
+		PoolSize      int
+		PollInterval  time.Duration
+		LeaseDuration time.Duration
+		ReapInterval  time.Duration
 	}
 }
 
@@ -55,6 +119,13 @@ func LoadConfig() (*Config, error) {
 	cfg.Server.ReadTimeout = getEnvDuration("SERVER_READ_TIMEOUT", "15s")
 	cfg.Server.WriteTimeout = getEnvDuration("SERVER_WRITE_TIMEOUT", "15s")
 	cfg.Server.IdleTimeout = getEnvDuration("SERVER_IDLE_TIMEOUT", "60s")
+	cfg.Server.AdminAPIKey = getEnv("ADMIN_API_KEY", "")
+
+	clientKeys, err := parseClientAPIKeys(getEnv("CLIENT_API_KEYS", ""))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Server.ClientAPIKeys = clientKeys
 
 	cfg.Database.Host = getEnv("DB_HOST", "localhost")
 	cfg.Database.Port = getEnv("DB_PORT", "5432")
@@ -68,20 +139,134 @@ func LoadConfig() (*Config, error) {
 	cfg.MLService.BaseURL = getEnv("ML_SERVICE_URL", "http://localhost:8000")
 	cfg.MLService.Timeout = getEnvDuration("ML_SERVICE_TIMEOUT", "30s")
 	cfg.MLService.APIKey = getEnv("ML_SERVICE_API_KEY", "")
+	cfg.MLService.Transport = getEnv("ML_SERVICE_TRANSPORT", "path")
+	cfg.MLService.MaxRetries = getEnvInt("ML_SERVICE_MAX_RETRIES", 2)
+	cfg.MLService.RetryBaseDelay = getEnvDuration("ML_SERVICE_RETRY_BASE_DELAY", "200ms")
+	cfg.MLService.RetryMaxDelay = getEnvDuration("ML_SERVICE_RETRY_MAX_DELAY", "2s")
+	cfg.MLService.BreakerThreshold = getEnvInt("ML_SERVICE_BREAKER_THRESHOLD", 5)
+	cfg.MLService.BreakerOpenTimeout = getEnvDuration("ML_SERVICE_BREAKER_OPEN_TIMEOUT", "30s")
+	cfg.MLService.HedgePercentile = getEnvFloat("ML_HEDGE_PERCENTILE", 0)
+	cfg.MLService.HedgeMinDelay = getEnvDuration("ML_HEDGE_MIN_DELAY", "50ms")
+	cfg.MLService.HedgeMaxDelay = getEnvDuration("ML_HEDGE_MAX_DELAY", "1s")
+	if cfg.MLService.HedgePercentile < 0 || cfg.MLService.HedgePercentile >= 100 {
+		return nil, fmt.Errorf("ML_HEDGE_PERCENTILE must be between 0 and 100, got %v", cfg.MLService.HedgePercentile)
+	}
+	cfg.MLService.ShadowConcurrency = getEnvInt("ML_SHADOW_CONCURRENCY", 2)
+	cfg.MLService.CassetteMode = getEnv("ML_CASSETTE_MODE", "off")
+	cfg.MLService.CassettePath = getEnv("ML_CASSETTE_PATH", "./ml_cassette.jsonl")
+	cfg.MLService.MaxInFlight = getEnvInt("ML_MAX_IN_FLIGHT", 0)
+	cfg.MLService.MaxQueued = getEnvInt("ML_MAX_QUEUED", 8)
+	cfg.MLService.QueueTimeout = getEnvDuration("ML_QUEUE_TIMEOUT", "2s")
+
+	endpoints, err := parseMLEndpoints("ML_SERVICE_ENDPOINTS", getEnv("ML_SERVICE_ENDPOINTS", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		endpoints = []MLEndpoint{{Name: "default", URL: cfg.MLService.BaseURL, Weight: 100}}
+	}
+	cfg.MLService.Endpoints = endpoints
+
+	cfg.MLService.ShadowEndpoints, err = parseMLEndpoints("ML_SHADOW_ENDPOINTS", getEnv("ML_SHADOW_ENDPOINTS", ""))
+	if err != nil {
+		return nil, err
+	}
 
 	cfg.Storage.UploadPath = getEnv("UPLOAD_PATH", "./uploads")
 	cfg.Storage.MaxFileSize = getEnvInt64("MAX_FILE_SIZE", 10485760) // 10MB
 	allowedTypesStr := getEnv("ALLOWED_TYPES", "image/jpeg,image/jpg,image/png")
 	cfg.Storage.AllowedTypes = strings.Split(allowedTypesStr, ",")
+	cfg.Storage.AutoPredict = getEnvBool("AUTO_PREDICT_ON_UPLOAD", false)
 
 	cfg.Queue.Enabled = getEnvBool("QUEUE_ENABLED", false)
 	cfg.Queue.Type = getEnv("QUEUE_TYPE", "db")
 	cfg.Queue.URL = getEnv("QUEUE_URL", "")
 	cfg.Queue.QueueName = getEnv("QUEUE_NAME", "prediction_jobs")
+	cfg.Queue.MaxRetries = getEnvInt("QUEUE_MAX_RETRIES", 3)
+	cfg.Queue.BatchMaxSize = getEnvInt("QUEUE_BATCH_MAX_SIZE", 1000)
+	cfg.Queue.OutboxInterval = getEnvDuration("QUEUE_OUTBOX_INTERVAL", "1s")
+	cfg.Queue.Partitions = getEnvInt("QUEUE_PARTITIONS", 0)
+	cfg.Queue.RetryBaseDelay = getEnvDuration("QUEUE_RETRY_BASE_DELAY", "5s")
+	cfg.Queue.RetryMaxDelay = getEnvDuration("QUEUE_RETRY_MAX_DELAY", "10m")
+	cfg.Queue.RetryJitter = getEnvFloat("QUEUE_RETRY_JITTER", 0.5)
+
+	cfg.Worker.Enabled = getEnvBool("WORKER_ENABLED", true)
+	cfg.Worker.PoolSize = getEnvInt("WORKER_POOL_SIZE", 4)
+	cfg.Worker.PollInterval = getEnvDuration("WORKER_POLL_INTERVAL", "2s")
+	cfg.Worker.LeaseDuration = getEnvDuration("WORKER_LEASE_DURATION", "60s")
+	cfg.Worker.ReapInterval = getEnvDuration("WORKER_REAP_INTERVAL", "30s")
 
 	return cfg, nil
 }
 
+// parseMLEndpoints parses the value of the key variable, a comma-separated
+// list of name|url|model_version|weight entries.
+func parseMLEndpoints(key, value string) ([]MLEndpoint, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var endpoints []MLEndpoint
+	totalWeight := 0
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(entry), "|")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid %s entry %q: want name|url|model_version|weight", key, entry)
+		}
+
+		weight, err := strconv.Atoi(fields[3])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight in %s entry %q", key, entry)
+		}
+
+		name := fields[0]
+		if name == "" || fields[1] == "" {
+			return nil, fmt.Errorf("%s entry %q needs a name and a url", key, entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate ML endpoint name %q", name)
+		}
+		seen[name] = true
+
+		endpoints = append(endpoints, MLEndpoint{
+			Name:         name,
+			URL:          fields[1],
+			ModelVersion: fields[2],
+			Weight:       weight,
+		})
+		totalWeight += weight
+	}
+
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("%s weights must not all be zero", key)
+	}
+
+	return endpoints, nil
+}
+
+// parseClientAPIKeys parses CLIENT_API_KEYS, a comma-separated list of
+// client|key entries.
+func parseClientAPIKeys(value string) (map[string]string, error) {
+	keys := map[string]string{}
+	if strings.TrimSpace(value) == "" {
+		return keys, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(entry), "|")
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("invalid CLIENT_API_KEYS entry %q: want client|key", entry)
+		}
+		if _, ok := keys[fields[1]]; ok {
+			return nil, fmt.Errorf("duplicate key in CLIENT_API_KEYS entry %q", entry)
+		}
+		keys[fields[1]] = fields[0]
+	}
+
+	return keys, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -107,6 +292,15 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -14,8 +14,9 @@ type DB struct {
 	*sqlx.DB
 }
 
-func Connect(cfg config.Config) (*DB, error) {
-	dsn := fmt.Sprintf(
+// DSN builds the lib/pq connection string for the configured database.
+func DSN(cfg config.Config) string {
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Database.Host,
 		cfg.Database.Port,
@@ -24,8 +25,10 @@ func Connect(cfg config.Config) (*DB, error) {
 		cfg.Database.DBName,
 		cfg.Database.SSLMode,
 	)
+}
 
-	db, err := sqlx.Connect("postgres", dsn)
+func Connect(cfg config.Config) (*DB, error) {
+	db, err := sqlx.Connect("postgres", DSN(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -45,6 +48,26 @@ func (db *DB) Close() error {
 	return db.DB.Close()
 }
 
+// WithTx runs fn in a transaction, committing when fn returns nil and rolling
+// back otherwise.
+func (db *DB) WithTx(fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
 func (db *DB) RunMigrations() error {
 	migrationSQL := `
 -- Enable UUID extension
@@ -79,20 +102,111 @@ CREATE TABLE IF NOT EXISTS predictions (
     completed_at TIMESTAMP
 );
 
+-- Пакетные запросы на анализ множества изображений
+CREATE TABLE IF NOT EXISTS prediction_batches (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id VARCHAR(255),
+    priority INTEGER NOT NULL DEFAULT 5,
+    filter JSONB,
+    total_items INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Опциональная таблица для job queue (если не используем RabbitMQ/Kafka)
 CREATE TABLE IF NOT EXISTS prediction_jobs (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     image_id UUID REFERENCES car_images(id) ON DELETE CASCADE,
-    status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'completed', 'failed')),
+    status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'completed', 'failed', 'dead_letter', 'cancelled')),
     retry_count INTEGER DEFAULT 0,
     max_retries INTEGER DEFAULT 3,
     scheduled_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     started_at TIMESTAMP,
     completed_at TIMESTAMP,
     error_message TEXT,
+    prediction_id UUID REFERENCES predictions(id) ON DELETE SET NULL,
+    locked_by VARCHAR(255),
+    lease_expires_at TIMESTAMP,
+    priority INTEGER NOT NULL DEFAULT 5,
+    client_id VARCHAR(255),
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    batch_id UUID REFERENCES prediction_batches(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Transactional outbox: сообщения для брокера пишутся в одной транзакции с задачей и публикуются relay'ем
+CREATE TABLE IF NOT EXISTS job_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('publish', 'dead_letter')),
+    payload JSONB NOT NULL,
+    delay_ms BIGINT NOT NULL DEFAULT 0,
+    reason TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+-- Теневые предсказания кандидатных моделей (shadow mode), клиенту не возвращаются
+CREATE TABLE IF NOT EXISTS shadow_predictions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    prediction_id UUID NOT NULL REFERENCES predictions(id) ON DELETE CASCADE,
+    image_id UUID NOT NULL REFERENCES car_images(id) ON DELETE CASCADE,
+    ml_variant VARCHAR(100) NOT NULL,
+    ml_model_version VARCHAR(50),
+    cleanliness_status VARCHAR(20),
+    cleanliness_confidence DECIMAL(5,4),
+    integrity_status VARCHAR(20),
+    integrity_confidence DECIMAL(5,4),
+    processing_time_ms INTEGER,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('completed', 'failed')),
+    error_message TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Связь задачи очереди с созданным предсказанием
+ALTER TABLE prediction_jobs ADD COLUMN IF NOT EXISTS prediction_id UUID REFERENCES predictions(id) ON DELETE SET NULL;
+
+-- Аренда задачи воркером (lease), продлевается heartbeat'ом во время обработки
+ALTER TABLE prediction_jobs ADD COLUMN IF NOT EXISTS locked_by VARCHAR(255);
+ALTER TABLE prediction_jobs ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP;
+
+-- Статусы dead_letter (задача исчерпала попытки или упала без шанса на повтор) и cancelled (отменена через API)
+-- (ограничение пересоздаётся только если в нём ещё нет этих статусов, чтобы не блокировать таблицу при каждом старте)
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conname = 'prediction_jobs_status_check'
+          AND conrelid = 'prediction_jobs'::regclass
+          AND pg_get_constraintdef(oid) LIKE '%dead_letter%'
+          AND pg_get_constraintdef(oid) LIKE '%cancelled%'
+    ) THEN
+        ALTER TABLE prediction_jobs DROP CONSTRAINT IF EXISTS prediction_jobs_status_check;
+        ALTER TABLE prediction_jobs ADD CONSTRAINT prediction_jobs_status_check
+            CHECK (status IN ('pending', 'processing', 'completed', 'failed', 'dead_letter', 'cancelled'));
+    END IF;
+END $$;
+
+-- Приоритет задачи (0 - фоновая выгрузка, 10 - интерактивный запрос) и клиент для честного распределения
+ALTER TABLE prediction_jobs ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 5;
+ALTER TABLE prediction_jobs ADD COLUMN IF NOT EXISTS client_id VARCHAR(255);
+
+-- Отмена задач через API: pending сразу становится cancelled, processing получает флаг для воркера
+ALTER TABLE prediction_jobs ADD COLUMN IF NOT EXISTS cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Принадлежность задачи пакетному запросу
+ALTER TABLE prediction_jobs ADD COLUMN IF NOT EXISTS batch_id UUID REFERENCES prediction_batches(id) ON DELETE SET NULL;
+
+-- Вариант ML сервиса (endpoint), который сделал предсказание, для сравнения моделей
+ALTER TABLE predictions ADD COLUMN IF NOT EXISTS ml_variant VARCHAR(100) NOT NULL DEFAULT 'default';
+
+-- Машиночитаемая причина неуспешного предсказания (например, invalid_label для ответа ML сервиса вне схемы)
+ALTER TABLE predictions ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(50) NOT NULL DEFAULT '';
+
+-- SHA-256 содержимого файла для повторного использования предсказаний при повторной загрузке того же фото
+ALTER TABLE car_images ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64) NOT NULL DEFAULT '';
+
 -- Создание индексов только если они не существуют
 DO $$
 BEGIN
@@ -120,6 +234,26 @@ BEGIN
         CREATE INDEX idx_prediction_jobs_scheduled_at ON prediction_jobs(scheduled_at);
     END IF;
 
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_prediction_jobs_prediction_id') THEN
+        CREATE INDEX idx_prediction_jobs_prediction_id ON prediction_jobs(prediction_id);
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_prediction_jobs_lease_expires_at') THEN
+        CREATE INDEX idx_prediction_jobs_lease_expires_at ON prediction_jobs(lease_expires_at) WHERE status = 'processing';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_job_outbox_unpublished') THEN
+        CREATE INDEX idx_job_outbox_unpublished ON job_outbox(available_at) WHERE published_at IS NULL;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_prediction_jobs_batch_id') THEN
+        CREATE INDEX idx_prediction_jobs_batch_id ON prediction_jobs(batch_id) WHERE batch_id IS NOT NULL;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_prediction_jobs_pending_priority') THEN
+        CREATE INDEX idx_prediction_jobs_pending_priority ON prediction_jobs(priority DESC, scheduled_at) WHERE status = 'pending';
+    END IF;
+
     IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_car_images_filename') THEN
         CREATE INDEX idx_car_images_filename ON car_images(filename);
     END IF;
@@ -127,6 +261,17 @@ BEGIN
     IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_predictions_statuses') THEN
         CREATE INDEX idx_predictions_statuses ON predictions(cleanliness_status, integrity_status);
     END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_car_images_content_hash') THEN
+        CREATE INDEX idx_car_images_content_hash ON car_images(content_hash) WHERE content_hash <> '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_shadow_predictions_prediction_id') THEN
+        CREATE INDEX idx_shadow_predictions_prediction_id ON shadow_predictions(prediction_id);
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_shadow_predictions_created_at') THEN
+        CREATE INDEX idx_shadow_predictions_created_at ON shadow_predictions(created_at);
+    END IF;
 END
 $$;
 `
@@ -139,8 +284,8 @@ $$;
 	return nil
 }
 
-func (db *DB) HealthCheck() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (db *DB) HealthCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	return db.PingContext(ctx)
@@ -0,0 +1,4 @@
+-- Связь задачи очереди с созданным предсказанием
+ALTER TABLE prediction_jobs ADD COLUMN prediction_id UUID REFERENCES predictions(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_prediction_jobs_prediction_id ON prediction_jobs(prediction_id);
@@ -0,0 +1,5 @@
+-- Аренда задачи воркером (lease), продлевается heartbeat'ом во время обработки
+ALTER TABLE prediction_jobs ADD COLUMN locked_by VARCHAR(255);
+ALTER TABLE prediction_jobs ADD COLUMN lease_expires_at TIMESTAMP;
+
+CREATE INDEX idx_prediction_jobs_lease_expires_at ON prediction_jobs(lease_expires_at) WHERE status = 'processing';
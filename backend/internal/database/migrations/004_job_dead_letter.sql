@@ -0,0 +1,4 @@
+-- Статус dead_letter для задач, исчерпавших попытки или упавших без шанса на повтор
+ALTER TABLE prediction_jobs DROP CONSTRAINT IF EXISTS prediction_jobs_status_check;
+ALTER TABLE prediction_jobs ADD CONSTRAINT prediction_jobs_status_check
+    CHECK (status IN ('pending', 'processing', 'completed', 'failed', 'dead_letter'));
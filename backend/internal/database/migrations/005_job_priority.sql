@@ -0,0 +1,5 @@
+-- Приоритет задачи (0 - фоновая выгрузка, 10 - интерактивный запрос) и клиент для честного распределения
+ALTER TABLE prediction_jobs ADD COLUMN priority INTEGER NOT NULL DEFAULT 5;
+ALTER TABLE prediction_jobs ADD COLUMN client_id VARCHAR(255);
+
+CREATE INDEX idx_prediction_jobs_pending_priority ON prediction_jobs(priority DESC, scheduled_at) WHERE status = 'pending';
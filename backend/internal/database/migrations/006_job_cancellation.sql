@@ -0,0 +1,5 @@
+-- Отмена задач через API: pending сразу становится cancelled, processing получает флаг для воркера
+ALTER TABLE prediction_jobs ADD COLUMN cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE prediction_jobs DROP CONSTRAINT IF EXISTS prediction_jobs_status_check;
+ALTER TABLE prediction_jobs ADD CONSTRAINT prediction_jobs_status_check
+    CHECK (status IN ('pending', 'processing', 'completed', 'failed', 'dead_letter', 'cancelled'));
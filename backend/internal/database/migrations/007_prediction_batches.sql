@@ -0,0 +1,14 @@
+-- Пакетные запросы на анализ множества изображений
+CREATE TABLE prediction_batches (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id VARCHAR(255),
+    priority INTEGER NOT NULL DEFAULT 5,
+    filter JSONB,
+    total_items INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Принадлежность задачи пакетному запросу
+ALTER TABLE prediction_jobs ADD COLUMN batch_id UUID REFERENCES prediction_batches(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_prediction_jobs_batch_id ON prediction_jobs(batch_id) WHERE batch_id IS NOT NULL;
@@ -0,0 +1,15 @@
+-- Transactional outbox: сообщения для брокера пишутся в одной транзакции с задачей и публикуются relay'ем
+CREATE TABLE job_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('publish', 'dead_letter')),
+    payload JSONB NOT NULL,
+    delay_ms BIGINT NOT NULL DEFAULT 0,
+    reason TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX idx_job_outbox_unpublished ON job_outbox(available_at) WHERE published_at IS NULL;
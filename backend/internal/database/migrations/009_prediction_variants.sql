@@ -0,0 +1,2 @@
+-- Вариант ML сервиса (endpoint), который сделал предсказание, для сравнения моделей
+ALTER TABLE predictions ADD COLUMN ml_variant VARCHAR(100) NOT NULL DEFAULT 'default';
@@ -0,0 +1,19 @@
+-- Теневые предсказания кандидатных моделей (shadow mode), клиенту не возвращаются
+CREATE TABLE shadow_predictions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    prediction_id UUID NOT NULL REFERENCES predictions(id) ON DELETE CASCADE,
+    image_id UUID NOT NULL REFERENCES car_images(id) ON DELETE CASCADE,
+    ml_variant VARCHAR(100) NOT NULL,
+    ml_model_version VARCHAR(50),
+    cleanliness_status VARCHAR(20),
+    cleanliness_confidence DECIMAL(5,4),
+    integrity_status VARCHAR(20),
+    integrity_confidence DECIMAL(5,4),
+    processing_time_ms INTEGER,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('completed', 'failed')),
+    error_message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_shadow_predictions_prediction_id ON shadow_predictions(prediction_id);
+CREATE INDEX idx_shadow_predictions_created_at ON shadow_predictions(created_at);
@@ -0,0 +1,2 @@
+-- Машиночитаемая причина неуспешного предсказания (например, invalid_label для ответа ML сервиса вне схемы)
+ALTER TABLE predictions ADD COLUMN failure_reason VARCHAR(50) NOT NULL DEFAULT '';
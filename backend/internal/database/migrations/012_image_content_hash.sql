@@ -0,0 +1,4 @@
+-- SHA-256 содержимого файла для повторного использования предсказаний при повторной загрузке того же фото
+ALTER TABLE car_images ADD COLUMN content_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_car_images_content_hash ON car_images(content_hash) WHERE content_hash <> '';
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"car-status-backend/internal/middleware"
+	"car-status-backend/internal/models"
+	"car-status-backend/internal/services"
+	"car-status-backend/pkg/utils"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// PredictBatch serves POST /api/v1/predict/batch. It queues one job per image,
+// taken either from image_ids or from a filter, and returns the batch ID to
+// poll at /api/v1/batches/{id}. Batches default to low priority so they never
+// hold up interactive predictions.
+func (h *PredictionHandler) PredictBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.queueService == nil || h.batchService == nil {
+		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Batch predictions require the queue to be enabled")
+		return
+	}
+
+	var req models.BatchPredictRequest
+	if err := utils.ParseRequestBody(r, &req); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if (len(req.ImageIDs) == 0) == (req.Filter == nil) {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Exactly one of image_ids and filter is required")
+		return
+	}
+
+	opts := models.JobOptions{
+		Priority: models.JobPriorityLow,
+		ClientID: middleware.ClientID(r),
+	}
+	if req.Priority != "" {
+		priority, err := parseJobPriority(req.Priority)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts.Priority = priority
+	}
+
+	maxSize := h.batchService.MaxSize()
+	var images []models.CarImage
+	var rejected []models.BatchItem
+
+	if req.Filter != nil {
+		filter := req.Filter
+		if !filter.UploadedToday && filter.UploadedAfter == nil && filter.UploadedBefore == nil && !filter.WithoutPrediction {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "filter must set at least one condition")
+			return
+		}
+
+		found, err := h.imageService.FindImages(r.Context(), *filter, maxSize+1)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to find images")
+			return
+		}
+		if len(found) > maxSize {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("filter matches more than %d images, narrow it down", maxSize))
+			return
+		}
+		images = found
+	} else {
+		imageIDs := uniqueIDs(req.ImageIDs)
+		if len(imageIDs) > maxSize {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("a batch may contain at most %d images", maxSize))
+			return
+		}
+
+		found, err := h.imageService.GetImagesByIDs(r.Context(), imageIDs)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get images")
+			return
+		}
+
+		byID := make(map[uuid.UUID]models.CarImage, len(found))
+		for _, image := range found {
+			byID[image.ID] = image
+		}
+		for _, id := range imageIDs {
+			image, ok := byID[id]
+			if !ok {
+				rejected = append(rejected, models.BatchItem{ImageID: id, Status: string(models.JobStatusFailed), Error: "image not found"})
+				continue
+			}
+			images = append(images, image)
+		}
+	}
+
+	if len(images) == 0 {
+		utils.WriteErrorResponseWithDetails(w, http.StatusBadRequest, "No images to predict", rejected)
+		return
+	}
+
+	batch, jobs, err := h.batchService.CreateBatch(r.Context(), images, req.Filter, opts)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create batch")
+		return
+	}
+
+	response := h.buildBatchResponse(batch, jobs, nil)
+	response.Rejected = rejected
+	response.Message = fmt.Sprintf("%d prediction jobs have been queued", len(jobs))
+
+	utils.WriteSuccessResponse(w, http.StatusAccepted, response, "Batch queued successfully")
+}
+
+// GetBatch serves GET /api/v1/batches/{id} with aggregate progress and the
+// state and result of every item.
+func (h *PredictionHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.batchService == nil {
+		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Batch predictions require the queue to be enabled")
+		return
+	}
+
+	batchIDStr := utils.ExtractIDFromPath(r.URL.Path, "/api/v1/batches/")
+	if batchIDStr == "" {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Batch ID is required")
+		return
+	}
+
+	if err := utils.ValidateUUID(batchIDStr); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid batch ID format")
+		return
+	}
+
+	batchID, _ := uuid.Parse(batchIDStr)
+	batch, jobs, err := h.batchService.GetBatch(r.Context(), batchID)
+	if errors.Is(err, services.ErrBatchNotFound) {
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Batch not found")
+		return
+	}
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get batch")
+		return
+	}
+
+	var predictionIDs []uuid.UUID
+	for _, job := range jobs {
+		if job.PredictionID != nil {
+			predictionIDs = append(predictionIDs, *job.PredictionID)
+		}
+	}
+
+	predictions := map[uuid.UUID]*models.Prediction{}
+	if len(predictionIDs) > 0 {
+		found, err := h.predictionService.GetPredictionsByIDs(r.Context(), predictionIDs)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get batch results")
+			return
+		}
+		for i := range found {
+			predictions[found[i].ID] = &found[i]
+		}
+	}
+
+	response := h.buildBatchResponse(batch, jobs, predictions)
+	utils.WriteSuccessResponse(w, http.StatusOK, response, "Batch retrieved successfully")
+}
+
+func (h *PredictionHandler) buildBatchResponse(batch *models.PredictionBatch, jobs []models.PredictionJob, predictions map[uuid.UUID]*models.Prediction) models.BatchResponse {
+	response := models.BatchResponse{
+		ID:        batch.ID,
+		Total:     batch.TotalItems,
+		Priority:  batch.Priority,
+		Items:     make([]models.BatchItem, 0, len(jobs)),
+		CreatedAt: batch.CreatedAt,
+	}
+
+	progress := &response.Progress
+	for _, job := range jobs {
+		jobID := job.ID
+		item := models.BatchItem{
+			ImageID:      job.ImageID,
+			JobID:        &jobID,
+			Status:       job.Status,
+			PredictionID: job.PredictionID,
+			Error:        job.ErrorMessage,
+		}
+
+		if job.PredictionID != nil {
+			if prediction, ok := predictions[*job.PredictionID]; ok {
+				predictionResponse := h.buildPredictionResponse(prediction)
+				item.Prediction = &predictionResponse
+			}
+		}
+
+		switch models.JobStatus(job.Status) {
+		case models.JobStatusPending:
+			progress.Pending++
+		case models.JobStatusProcessing:
+			progress.Processing++
+		case models.JobStatusCompleted:
+			progress.Completed++
+		case models.JobStatusFailed:
+			progress.Failed++
+		case models.JobStatusDeadLetter:
+			progress.DeadLetter++
+		case models.JobStatusCancelled:
+			progress.Cancelled++
+		}
+
+		response.Items = append(response.Items, item)
+	}
+
+	progress.Done = progress.Completed + progress.Failed + progress.DeadLetter + progress.Cancelled
+	if response.Total > 0 {
+		progress.Percent = float64(progress.Done) * 100 / float64(response.Total)
+	}
+
+	response.Status = "running"
+	if progress.Done >= response.Total {
+		response.Status = "completed"
+	}
+
+	return response
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
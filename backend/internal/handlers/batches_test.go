@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"car-status-backend/internal/models"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildBatchResponseCountsProgress(t *testing.T) {
+	batch := &models.PredictionBatch{ID: uuid.New(), TotalItems: 8}
+	statuses := []models.JobStatus{
+		models.JobStatusPending, models.JobStatusPending, models.JobStatusProcessing,
+		models.JobStatusCompleted, models.JobStatusCompleted, models.JobStatusFailed,
+		models.JobStatusDeadLetter, models.JobStatusCancelled,
+	}
+	jobs := make([]models.PredictionJob, len(statuses))
+	for i, status := range statuses {
+		jobs[i] = models.PredictionJob{ID: uuid.New(), ImageID: uuid.New(), Status: string(status)}
+	}
+
+	h := &PredictionHandler{}
+	response := h.buildBatchResponse(batch, jobs, nil)
+
+	want := models.BatchProgress{
+		Pending: 2, Processing: 1, Completed: 2, Failed: 1, DeadLetter: 1, Cancelled: 1,
+		Done: 5, Percent: 62.5,
+	}
+	if response.Progress != want {
+		t.Errorf("Progress = %+v, want %+v", response.Progress, want)
+	}
+	if response.Status != "running" || len(response.Items) != len(jobs) {
+		t.Errorf("status %q with %d items, want running with %d", response.Status, len(response.Items), len(jobs))
+	}
+
+	// The batch completes once every job has finished, whatever the outcome.
+	for i := range jobs[:3] {
+		jobs[i].Status = string(models.JobStatusCompleted)
+	}
+	response = h.buildBatchResponse(batch, jobs, nil)
+	if response.Status != "completed" || response.Progress.Percent != 100 {
+		t.Errorf("status %q at %.1f%%, want completed at 100%%", response.Status, response.Progress.Percent)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"car-status-backend/internal/database"
 	"car-status-backend/internal/services"
 	"car-status-backend/pkg/utils"
+	"fmt"
 	"net/http"
+	"time"
 )
 
 type HealthHandler struct {
@@ -27,16 +29,35 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 
 	checks := make(map[string]string)
 
-	if err := h.db.HealthCheck(); err != nil {
+	if err := h.db.HealthCheck(r.Context()); err != nil {
 		checks["database"] = "failed: " + err.Error()
 	} else {
 		checks["database"] = "ok"
 	}
 
-	if err := h.mlClient.HealthCheck(); err != nil {
-		checks["ml_service"] = "failed: " + err.Error()
-	} else {
-		checks["ml_service"] = "ok"
+	// With a single ML endpoint the checks keep their plain names; with
+	// several, every endpoint gets its own pair suffixed with its name.
+	endpoints := h.mlClient.Endpoints()
+	for _, endpoint := range endpoints {
+		suffix := ""
+		if len(endpoints) > 1 {
+			suffix = "_" + endpoint.Name
+		}
+
+		if err := h.mlClient.HealthCheck(r.Context(), endpoint.Name); err != nil {
+			checks["ml_service"+suffix] = "failed: " + err.Error()
+		} else {
+			checks["ml_service"+suffix] = "ok"
+		}
+
+		switch state, retryIn := h.mlClient.BreakerState(endpoint.Name); state {
+		case services.CircuitClosed:
+			checks["ml_circuit_breaker"+suffix] = "ok"
+		case services.CircuitOpen:
+			checks["ml_circuit_breaker"+suffix] = fmt.Sprintf("open: next probe in %s", retryIn.Round(time.Second))
+		default:
+			checks["ml_circuit_breaker"+suffix] = state
+		}
 	}
 
 	utils.WriteHealthResponse(w, "car-status-backend", checks)
@@ -48,7 +69,7 @@ func (h *HealthHandler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.HealthCheck(); err != nil {
+	if err := h.db.HealthCheck(r.Context()); err != nil {
 		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Database not ready")
 		return
 	}
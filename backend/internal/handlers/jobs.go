@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"car-status-backend/internal/middleware"
+	"car-status-backend/internal/models"
+	"car-status-backend/internal/services"
+	"car-status-backend/pkg/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type JobHandler struct {
+	queueService services.Queue
+}
+
+func NewJobHandler(queueService services.Queue) *JobHandler {
+	return &JobHandler{
+		queueService: queueService,
+	}
+}
+
+// HandleJob serves GET, DELETE and PATCH on /api/v1/jobs/{id}.
+func (h *JobHandler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetJob(w, r)
+	case http.MethodDelete:
+		h.CancelJob(w, r)
+	case http.MethodPatch:
+		h.UpdateJob(w, r)
+	default:
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	jobID, ok := h.parseJobID(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.queueService.Get(jobID)
+	if err != nil {
+		h.writeJobError(w, err, "Failed to get job")
+		return
+	}
+
+	response := buildJobResponse(job)
+	utils.WriteSuccessResponse(w, http.StatusOK, response, "Job retrieved successfully")
+}
+
+// CancelJob cancels a pending job right away. A processing job is only
+// flagged; its worker stops at the next checkpoint and marks it cancelled.
+func (h *JobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	jobID, ok := h.parseJobID(w, r)
+	if !ok || !h.checkOwner(w, r, jobID) {
+		return
+	}
+
+	job, err := h.queueService.Cancel(jobID)
+	if err != nil {
+		h.writeJobError(w, err, "Failed to cancel job")
+		return
+	}
+
+	response := buildJobResponse(job)
+	if job.Status == string(models.JobStatusCancelled) {
+		response.Message = "Job has been cancelled"
+		utils.WriteSuccessResponse(w, http.StatusOK, response, "Job cancelled successfully")
+		return
+	}
+
+	response.Message = "Cancellation requested, the worker will stop at the next checkpoint"
+	utils.WriteSuccessResponse(w, http.StatusAccepted, response, "Job cancellation requested")
+}
+
+// UpdateJob changes the priority or scheduled time of a pending job.
+func (h *JobHandler) UpdateJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	jobID, ok := h.parseJobID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.JobUpdateRequest
+	if err := utils.ParseRequestBody(r, &req); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Priority == nil && req.ScheduledAt == nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "priority or scheduled_at is required")
+		return
+	}
+
+	var update models.JobUpdate
+	if req.Priority != nil {
+		priority, err := parseJobPriority(*req.Priority)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		update.Priority = &priority
+	}
+	update.ScheduledAt = req.ScheduledAt
+
+	if !h.checkOwner(w, r, jobID) {
+		return
+	}
+
+	job, err := h.queueService.Update(jobID, update)
+	if err != nil {
+		h.writeJobError(w, err, "Failed to update job")
+		return
+	}
+
+	utils.WriteSuccessResponse(w, http.StatusOK, buildJobResponse(job), "Job updated successfully")
+}
+
+func (h *JobHandler) GetJobStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.queueService == nil {
+		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Queue service is disabled")
+		return
+	}
+
+	stats, err := h.queueService.Stats()
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get job stats")
+		return
+	}
+
+	utils.WriteSuccessResponse(w, http.StatusOK, stats, "Job stats retrieved successfully")
+}
+
+func (h *JobHandler) ListDeadLetterJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.queueService == nil {
+		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Queue service is disabled")
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || utils.ValidateNumericRange(parsed, "limit", 1, 200) != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and 200")
+			return
+		}
+		limit = parsed
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = parsed
+	}
+
+	jobs, total, err := h.queueService.ListDeadLetter(limit, offset)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get dead-letter jobs")
+		return
+	}
+
+	responses := make([]models.PredictionJobResponse, 0, len(jobs))
+	for i := range jobs {
+		responses = append(responses, buildJobResponse(&jobs[i]))
+	}
+
+	utils.WriteSuccessResponse(w, http.StatusOK, map[string]interface{}{
+		"jobs":   responses,
+		"count":  len(responses),
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	}, "Dead-letter jobs retrieved successfully")
+}
+
+// DeadLetterJob serves GET /api/v1/admin/jobs/dead-letter/{id} and
+// POST /api/v1/admin/jobs/dead-letter/{id}/requeue.
+func (h *JobHandler) DeadLetterJob(w http.ResponseWriter, r *http.Request) {
+	if h.queueService == nil {
+		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Queue service is disabled")
+		return
+	}
+
+	path := utils.ExtractIDFromPath(r.URL.Path, "/api/v1/admin/jobs/dead-letter/")
+	jobIDStr, action, _ := strings.Cut(path, "/")
+	if jobIDStr == "" {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Job ID is required")
+		return
+	}
+
+	if err := utils.ValidateUUID(jobIDStr); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	jobID, _ := uuid.Parse(jobIDStr)
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		job, err := h.queueService.Get(jobID)
+		if err != nil && !errors.Is(err, services.ErrJobNotFound) {
+			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get job")
+			return
+		}
+		if err != nil || job.Status != string(models.JobStatusDeadLetter) {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Dead-letter job not found")
+			return
+		}
+
+		utils.WriteSuccessResponse(w, http.StatusOK, buildJobResponse(job), "Dead-letter job retrieved successfully")
+	case action == "requeue" && r.Method == http.MethodPost:
+		job, err := h.queueService.Requeue(jobID)
+		if errors.Is(err, services.ErrJobNotFound) {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Dead-letter job not found")
+			return
+		}
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to requeue job")
+			return
+		}
+
+		response := buildJobResponse(job)
+		response.Message = "Job has been requeued for processing"
+		utils.WriteSuccessResponse(w, http.StatusOK, response, "Job requeued successfully")
+	case action == "" || action == "requeue":
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Unknown action")
+	}
+}
+
+// parseJobID validates the {id} segment of /api/v1/jobs/{id}, writing the
+// error response itself when it returns false.
+func (h *JobHandler) parseJobID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	if h.queueService == nil {
+		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Queue service is disabled")
+		return uuid.Nil, false
+	}
+
+	jobIDStr := utils.ExtractIDFromPath(r.URL.Path, "/api/v1/jobs/")
+	if jobIDStr == "" {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Job ID is required")
+		return uuid.Nil, false
+	}
+
+	if err := utils.ValidateUUID(jobIDStr); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid job ID format")
+		return uuid.Nil, false
+	}
+
+	jobID, _ := uuid.Parse(jobIDStr)
+	return jobID, true
+}
+
+// checkOwner makes sure the job was submitted by the calling client, so
+// clients cannot cancel or reprioritise each other's jobs. Jobs of other
+// clients are reported as not found, writing the response when it returns
+// false.
+func (h *JobHandler) checkOwner(w http.ResponseWriter, r *http.Request, jobID uuid.UUID) bool {
+	job, err := h.queueService.Get(jobID)
+	if err != nil {
+		h.writeJobError(w, err, "Failed to get job")
+		return false
+	}
+
+	if job.ClientID != middleware.ClientID(r) {
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Job not found")
+		return false
+	}
+	return true
+}
+
+func (h *JobHandler) writeJobError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Job not found")
+	case errors.Is(err, services.ErrJobFinished), errors.Is(err, services.ErrJobNotPending):
+		utils.WriteErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, message)
+	}
+}
+
+// parseJobOptions reads the job priority from the "priority" query parameter
+// or the optional JSON body, and the submitting client resolved from its API
+// key (falling back to the caller's address) for fair scheduling.
+func parseJobOptions(r *http.Request) (models.JobOptions, error) {
+	priority := r.URL.Query().Get("priority")
+
+	if r.ContentLength > 0 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body models.PredictOptions
+		if err := utils.ParseRequestBody(r, &body); err != nil {
+			return models.JobOptions{}, fmt.Errorf("request body must be valid JSON")
+		}
+		if body.Priority != "" {
+			priority = body.Priority
+		}
+	}
+
+	opts := models.JobOptions{
+		Priority: models.JobPriorityNormal,
+		ClientID: middleware.ClientID(r),
+	}
+
+	if priority != "" {
+		parsed, err := parseJobPriority(priority)
+		if err != nil {
+			return models.JobOptions{}, err
+		}
+		opts.Priority = parsed
+	}
+
+	return opts, nil
+}
+
+func parseJobPriority(value string) (int, error) {
+	switch strings.ToLower(value) {
+	case "low":
+		return models.JobPriorityLow, nil
+	case "normal":
+		return models.JobPriorityNormal, nil
+	case "high":
+		return models.JobPriorityHigh, nil
+	}
+
+	priority, err := strconv.Atoi(value)
+	if err != nil || utils.ValidateNumericRange(priority, "priority", models.JobPriorityLow, models.JobPriorityHigh) != nil {
+		return 0, fmt.Errorf("priority must be low, normal, high or a number between %d and %d", models.JobPriorityLow, models.JobPriorityHigh)
+	}
+
+	return priority, nil
+}
+
+func buildJobResponse(job *models.PredictionJob) models.PredictionJobResponse {
+	return models.PredictionJobResponse{
+		ID:              job.ID,
+		ImageID:         job.ImageID,
+		Status:          job.Status,
+		RetryCount:      job.RetryCount,
+		MaxRetries:      job.MaxRetries,
+		Priority:        job.Priority,
+		ClientID:        job.ClientID,
+		CancelRequested: job.CancelRequested,
+		ErrorMessage:    job.ErrorMessage,
+		PredictionID:    job.PredictionID,
+		ScheduledAt:     job.ScheduledAt,
+		StartedAt:       job.StartedAt,
+		CreatedAt:       job.CreatedAt,
+		CompletedAt:     job.CompletedAt,
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"car-status-backend/internal/models"
+	"car-status-backend/internal/services"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// brokenQueue fails every lookup the way a queue does when its database is
+// unreachable.
+type brokenQueue struct {
+	services.Queue
+}
+
+func (brokenQueue) Get(jobID uuid.UUID) (*models.PredictionJob, error) {
+	return nil, errors.New("failed to get job: connection refused")
+}
+
+func (brokenQueue) Requeue(jobID uuid.UUID) (*models.PredictionJob, error) {
+	return nil, errors.New("failed to requeue job: connection refused")
+}
+
+func serveJob(handler http.HandlerFunc, method, path string) *httptest.ResponseRecorder {
+	return serveJobAs(handler, "192.0.2.1", method, path, "")
+}
+
+// serveJobAs sends the request from the given client address, which
+// identifies the client when no API key is configured.
+func serveJobAs(handler http.HandlerFunc, client, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.RemoteAddr = client + ":1234"
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	return recorder
+}
+
+func TestJobHandlerMapsQueueErrors(t *testing.T) {
+	missing := uuid.New().String()
+	memory := NewJobHandler(services.NewMemoryQueue(3, services.RetryPolicy{}))
+	broken := NewJobHandler(brokenQueue{})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+		want    int
+	}{
+		{"get missing job", memory.HandleJob, http.MethodGet, "/api/v1/jobs/" + missing, http.StatusNotFound},
+		{"get with failing queue", broken.HandleJob, http.MethodGet, "/api/v1/jobs/" + missing, http.StatusInternalServerError},
+		{"requeue missing job", memory.DeadLetterJob, http.MethodPost, "/api/v1/admin/jobs/dead-letter/" + missing + "/requeue", http.StatusNotFound},
+		{"requeue with failing queue", broken.DeadLetterJob, http.MethodPost, "/api/v1/admin/jobs/dead-letter/" + missing + "/requeue", http.StatusInternalServerError},
+		{"get dead letter with failing queue", broken.DeadLetterJob, http.MethodGet, "/api/v1/admin/jobs/dead-letter/" + missing, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveJob(tt.handler, tt.method, tt.path).Code; got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobHandlerOnlyLetsOwnerChangeJob(t *testing.T) {
+	queue := services.NewMemoryQueue(3, services.RetryPolicy{})
+	h := NewJobHandler(queue)
+
+	job, err := queue.Publish(uuid.New(), "", models.JobOptions{ClientID: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	path := "/api/v1/jobs/" + job.ID.String()
+
+	if got := serveJobAs(h.HandleJob, "192.0.2.2", http.MethodPatch, path, `{"priority":"9"}`).Code; got != http.StatusNotFound {
+		t.Errorf("PATCH by another client = %d, want 404", got)
+	}
+	if got := serveJobAs(h.HandleJob, "192.0.2.2", http.MethodDelete, path, "").Code; got != http.StatusNotFound {
+		t.Errorf("DELETE by another client = %d, want 404", got)
+	}
+	if stored, _ := queue.Get(job.ID); stored.Priority != job.Priority || stored.Status != string(models.JobStatusPending) {
+		t.Fatalf("another client changed the job to priority %d, status %s", stored.Priority, stored.Status)
+	}
+
+	if got := serveJobAs(h.HandleJob, "192.0.2.1", http.MethodPatch, path, `{"priority":"9"}`).Code; got != http.StatusOK {
+		t.Errorf("PATCH by the owner = %d, want 200", got)
+	}
+	if got := serveJobAs(h.HandleJob, "192.0.2.1", http.MethodDelete, path, "").Code; got != http.StatusOK {
+		t.Errorf("DELETE by the owner = %d, want 200", got)
+	}
+	if stored, _ := queue.Get(job.ID); stored.Priority != 9 || stored.Status != string(models.JobStatusCancelled) {
+		t.Errorf("job has priority %d, status %s; want 9, cancelled", stored.Priority, stored.Status)
+	}
+}
@@ -4,30 +4,44 @@ import (
 	"car-status-backend/internal/models"
 	"car-status-backend/internal/services"
 	"car-status-backend/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 )
 
 type PredictionHandler struct {
 	imageService      *services.ImageService
 	predictionService *services.PredictionService
 	mlClient          *services.MLClient
-	queueService      *services.QueueService
+	queueService      services.Queue
+	batchService      *services.BatchService
+	shadowService     *services.ShadowService
+	mlLimiter         *services.MLLimiter
 }
 
 func NewPredictionHandler(
 	imageService *services.ImageService,
 	predictionService *services.PredictionService,
 	mlClient *services.MLClient,
-	queueService *services.QueueService,
+	queueService services.Queue,
+	batchService *services.BatchService,
+	shadowService *services.ShadowService,
+	mlLimiter *services.MLLimiter,
 ) *PredictionHandler {
 	return &PredictionHandler{
 		imageService:      imageService,
 		predictionService: predictionService,
 		mlClient:          mlClient,
 		queueService:      queueService,
+		batchService:      batchService,
+		shadowService:     shadowService,
+		mlLimiter:         mlLimiter,
 	}
 }
 
@@ -49,49 +63,54 @@ func (h *PredictionHandler) PredictImage(w http.ResponseWriter, r *http.Request)
 	}
 
 	imageID, _ := uuid.Parse(imageIDStr)
-	image, err := h.imageService.GetImageByID(imageID)
+	image, err := h.imageService.GetImageByID(r.Context(), imageID)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusNotFound, "Image not found")
 		return
 	}
 
+	force, err := parseForce(r.URL.Query().Get("force"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var opts models.JobOptions
 	if h.queueService != nil {
-		err = h.queueService.PublishPredictionJob(imageID, image.FilePath)
+		opts, err = parseJobOptions(r)
 		if err != nil {
-			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to queue prediction job")
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 			return
 		}
-
-		utils.WriteSuccessResponse(w, http.StatusAccepted, map[string]interface{}{
-			"image_id": imageID,
-			"status":   "queued",
-			"message":  "Prediction job has been queued for processing",
-		}, "Prediction job queued successfully")
-		return
 	}
 
-	start := time.Now()
-	mlResult, err := h.mlClient.PredictCarStatus(image.FilePath)
+	job, response, err := h.predict(r.Context(), image, opts, force)
 	if err != nil {
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to process image with ML service: "+err.Error())
+		writePredictError(w, err)
 		return
 	}
 
-	prediction, err := h.predictionService.CreatePrediction(imageID, mlResult)
-	if err != nil {
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to save prediction result")
+	if job != nil {
+		utils.WriteSuccessResponse(w, http.StatusAccepted, map[string]interface{}{
+			"job_id":   job.ID,
+			"image_id": imageID,
+			"priority": job.Priority,
+			"status":   "queued",
+			"message":  "Prediction job has been queued for processing",
+		}, "Prediction job queued successfully")
 		return
 	}
 
-	response := h.buildPredictionResponse(prediction)
-	response.Message = "Prediction completed successfully"
-
-	processingTime := time.Since(start)
-	if processingTime.Milliseconds() > 0 {
-		response.ProcessingTimeMs = int(processingTime.Milliseconds())
+	switch {
+	case response.Cached:
+		response.Message = "Prediction reused from an identical image"
+	case response.Status == "failed":
+		response.Message = "Prediction failed"
+	default:
+		response.Message = "Prediction completed successfully"
 	}
 
-	utils.WriteSuccessResponse(w, http.StatusOK, response, "Prediction completed successfully")
+	utils.WriteSuccessResponse(w, http.StatusOK, response, response.Message)
 }
 
 func (h *PredictionHandler) GetPrediction(w http.ResponseWriter, r *http.Request) {
@@ -112,7 +131,7 @@ func (h *PredictionHandler) GetPrediction(w http.ResponseWriter, r *http.Request
 	}
 
 	predictionID, _ := uuid.Parse(predictionIDStr)
-	prediction, err := h.predictionService.GetPredictionByID(predictionID)
+	prediction, err := h.predictionService.GetPredictionByID(r.Context(), predictionID)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusNotFound, "Prediction not found")
 		return
@@ -142,7 +161,7 @@ func (h *PredictionHandler) GetImagePredictions(w http.ResponseWriter, r *http.R
 	}
 
 	imageID, _ := uuid.Parse(imageIDStr)
-	predictions, err := h.predictionService.GetPredictionsByImageID(imageID)
+	predictions, err := h.predictionService.GetPredictionsByImageID(r.Context(), imageID)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get predictions")
 		return
@@ -167,21 +186,245 @@ func (h *PredictionHandler) GetPredictionStats(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	stats, err := h.predictionService.GetPredictionStats()
+	stats, err := h.predictionService.GetPredictionStats(r.Context())
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get prediction stats")
 		return
 	}
+	if h.mlLimiter != nil {
+		stats["ml_limiter"] = h.mlLimiter.Stats()
+	}
+	if h.mlClient.HedgingEnabled() {
+		stats["ml_hedging"] = h.mlClient.HedgeStats()
+	}
 
 	utils.WriteSuccessResponse(w, http.StatusOK, stats, "Prediction stats retrieved successfully")
 }
 
+// GetShadowReport compares the shadow models with the primary predictions
+// they mirrored over the last hours (24 by default).
+func (h *PredictionHandler) GetShadowReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.shadowService == nil {
+		utils.WriteErrorResponse(w, http.StatusServiceUnavailable, "Shadow predictions are disabled")
+		return
+	}
+
+	hours := 24
+	if value := r.URL.Query().Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || utils.ValidateNumericRange(parsed, "hours", 1, 720) != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "hours must be between 1 and 720")
+			return
+		}
+		hours = parsed
+	}
+
+	report, err := h.shadowService.AgreementReport(r.Context(), hours)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get shadow report")
+		return
+	}
+
+	utils.WriteSuccessResponse(w, http.StatusOK, report, "Shadow report retrieved successfully")
+}
+
+// predictError is a failure of predict together with the status and message
+// to answer it with.
+type predictError struct {
+	status     int
+	message    string
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *predictError) Error() string {
+	return e.message
+}
+
+func (e *predictError) Unwrap() error {
+	return e.err
+}
+
+// writePredictError answers a failed predict call.
+func writePredictError(w http.ResponseWriter, err error) {
+	var predictErr *predictError
+	if !errors.As(err, &predictErr) {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if predictErr.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(predictErr.retryAfter/time.Second)))
+	}
+	utils.WriteErrorResponse(w, predictErr.status, predictErr.message)
+}
+
+// predict queues a prediction job for image when the queue is enabled and
+// runs the prediction synchronously otherwise. Unless force is set, a
+// prediction for identical content is reused instead. Exactly one of the
+// returned job and prediction is set; errors are *predictError.
+func (h *PredictionHandler) predict(ctx context.Context, image *models.CarImage, opts models.JobOptions, force bool) (*models.PredictionJob, *models.PredictionResponse, error) {
+	if !force {
+		cached, err := h.cachedPrediction(ctx, image)
+		if err != nil {
+			return nil, nil, &predictError{status: http.StatusInternalServerError, message: "Failed to look up cached prediction", err: err}
+		}
+		if cached != nil {
+			return nil, cached, nil
+		}
+	}
+
+	if h.queueService != nil {
+		job, err := h.queueService.Publish(image.ID, image.FilePath, opts)
+		if err != nil {
+			return nil, nil, &predictError{status: http.StatusInternalServerError, message: "Failed to queue prediction job", err: err}
+		}
+		return job, nil, nil
+	}
+
+	start := time.Now()
+	mlCtx, release, err := h.acquireML(ctx)
+	if err != nil {
+		return nil, nil, h.shedError(err)
+	}
+	mlResult, err := h.mlClient.PredictCarStatus(mlCtx, image.ID, image.FilePath)
+	release()
+	if errors.Is(err, services.ErrCircuitOpen) {
+		return nil, nil, &predictError{status: http.StatusServiceUnavailable, message: "ML service is temporarily unavailable, try again later", err: err}
+	}
+	if err != nil {
+		return nil, nil, &predictError{status: http.StatusInternalServerError, message: "Failed to process image with ML service: " + err.Error(), err: err}
+	}
+
+	prediction, err := h.predictionService.CreatePrediction(ctx, image.ID, mlResult)
+	if err != nil {
+		return nil, nil, &predictError{status: http.StatusInternalServerError, message: "Failed to save prediction result", err: err}
+	}
+	h.mirror(prediction, image.FilePath)
+
+	response := h.buildPredictionResponse(prediction)
+	if processingTime := time.Since(start); processingTime.Milliseconds() > 0 {
+		response.ProcessingTimeMs = int(processingTime.Milliseconds())
+	}
+
+	return nil, &response, nil
+}
+
+// queueInTx is the queued half of predict for an image whose row is being
+// inserted in tx, so the image and its job are stored together. It returns
+// the completed prediction of an identical image when there is one; that is
+// reused with reusePrediction once tx has committed and no job is queued.
+func (h *PredictionHandler) queueInTx(ctx context.Context, tx *sqlx.Tx, image *models.CarImage, opts models.JobOptions, force bool) (*models.PredictionJob, *models.Prediction, error) {
+	if !force {
+		cached, err := h.findCachedPrediction(ctx, image)
+		if err != nil {
+			return nil, nil, &predictError{status: http.StatusInternalServerError, message: "Failed to look up cached prediction", err: err}
+		}
+		if cached != nil {
+			return nil, cached, nil
+		}
+	}
+
+	job, err := h.queueService.PublishTx(tx, image.ID, image.FilePath, opts)
+	if err != nil {
+		return nil, nil, &predictError{status: http.StatusInternalServerError, message: "Failed to queue prediction job", err: err}
+	}
+	return job, nil, nil
+}
+
+// cachedPrediction looks for a completed prediction of an image with the
+// same content hash, made by the model version image is routed to, and
+// reuses it for image. It returns nil when there is none.
+func (h *PredictionHandler) cachedPrediction(ctx context.Context, image *models.CarImage) (*models.PredictionResponse, error) {
+	cached, err := h.findCachedPrediction(ctx, image)
+	if err != nil || cached == nil {
+		return nil, err
+	}
+
+	return h.reusePrediction(ctx, cached, image)
+}
+
+func (h *PredictionHandler) findCachedPrediction(ctx context.Context, image *models.CarImage) (*models.Prediction, error) {
+	if image.ContentHash == "" {
+		return nil, nil
+	}
+
+	return h.predictionService.FindCachedPrediction(ctx, image.ContentHash, h.mlClient.ModelVersionFor(image.ID))
+}
+
+// reusePrediction copies the cached prediction to image.
+func (h *PredictionHandler) reusePrediction(ctx context.Context, cached *models.Prediction, image *models.CarImage) (*models.PredictionResponse, error) {
+	prediction, err := h.predictionService.ReusePrediction(ctx, cached, image.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := h.buildPredictionResponse(prediction)
+	response.Cached = true
+	return &response, nil
+}
+
+// parseForce parses the force flag that bypasses the prediction cache.
+func parseForce(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("force must be true or false")
+	}
+	return force, nil
+}
+
+// acquireML takes a slot for a synchronous ML call from the limiter, if one
+// is configured. The call must be made with the returned context, so a hedged
+// request takes a slot of its own, and the returned function releases the
+// slot.
+func (h *PredictionHandler) acquireML(ctx context.Context) (context.Context, func(), error) {
+	if h.mlLimiter == nil {
+		return ctx, func() {}, nil
+	}
+	if err := h.mlLimiter.Acquire(ctx); err != nil {
+		return nil, nil, err
+	}
+	return services.WithMLLimiter(ctx, h.mlLimiter), h.mlLimiter.Release, nil
+}
+
+// shedError turns a refusal of the ML limiter into a *predictError: 429 when
+// the wait queue is full, 503 when the request waited too long for a slot.
+func (h *PredictionHandler) shedError(err error) error {
+	shed := &predictError{
+		status:     http.StatusServiceUnavailable,
+		message:    "ML service is busy, try again later",
+		retryAfter: h.mlLimiter.RetryAfter(),
+		err:        err,
+	}
+	if errors.Is(err, services.ErrMLOverloaded) {
+		shed.status = http.StatusTooManyRequests
+		shed.message = "Too many predictions in progress, try again later"
+	}
+	return shed
+}
+
+// mirror hands a prediction to the shadow models, if any are configured.
+func (h *PredictionHandler) mirror(prediction *models.Prediction, imagePath string) {
+	if h.shadowService != nil {
+		h.shadowService.Mirror(prediction, imagePath)
+	}
+}
+
 func (h *PredictionHandler) buildPredictionResponse(prediction *models.Prediction) models.PredictionResponse {
 	response := models.PredictionResponse{
 		ID:               prediction.ID,
 		ImageID:          prediction.ImageID,
 		ProcessingTimeMs: prediction.ProcessingTimeMs,
 		ModelVersion:     prediction.MLModelVersion,
+		Variant:          prediction.MLVariant,
 		Status:           prediction.Status,
 		CreatedAt:        prediction.CreatedAt,
 		CompletedAt:      prediction.CompletedAt,
@@ -194,5 +437,10 @@ func (h *PredictionHandler) buildPredictionResponse(prediction *models.Predictio
 		response.Integrity.Confidence = prediction.IntegrityConfidence
 	}
 
+	if prediction.Status == "failed" {
+		response.Error = prediction.ErrorMessage
+		response.FailureReason = prediction.FailureReason
+	}
+
 	return response
 }
\ No newline at end of file
@@ -4,18 +4,28 @@ import (
 	"car-status-backend/internal/models"
 	"car-status-backend/internal/services"
 	"car-status-backend/pkg/utils"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 )
 
 type UploadHandler struct {
 	imageService *services.ImageService
+	predictions  *PredictionHandler
+	autoPredict  bool
 }
 
-func NewUploadHandler(imageService *services.ImageService) *UploadHandler {
+// NewUploadHandler creates the upload handler. autoPredict is the default for
+// the auto_predict form field; predictions runs or queues those predictions.
+func NewUploadHandler(imageService *services.ImageService, predictions *PredictionHandler, autoPredict bool) *UploadHandler {
 	return &UploadHandler{
 		imageService: imageService,
+		predictions:  predictions,
+		autoPredict:  autoPredict,
 	}
 }
 
@@ -43,7 +53,57 @@ func (h *UploadHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	image, err := h.imageService.UploadImage(file, header)
+	autoPredict := h.autoPredict
+	if value := r.PostFormValue("auto_predict"); value != "" {
+		autoPredict, err = strconv.ParseBool(value)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "auto_predict must be true or false")
+			return
+		}
+	}
+
+	var opts models.JobOptions
+	var force bool
+	if autoPredict {
+		force, err = parseForce(r.PostFormValue("force"))
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts, err = parseJobOptions(r)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if value := r.PostFormValue("priority"); value != "" {
+			opts.Priority, err = parseJobPriority(value)
+			if err != nil {
+				utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	// Queued predictions are published in the transaction that stores the
+	// image, so an image is never left without the job it was uploaded for.
+	var job *models.PredictionJob
+	var cached *models.Prediction
+	var inTx func(tx *sqlx.Tx, image *models.CarImage) error
+	if autoPredict && h.predictions.queueService != nil {
+		inTx = func(tx *sqlx.Tx, image *models.CarImage) error {
+			var err error
+			job, cached, err = h.predictions.queueInTx(r.Context(), tx, image, opts, force)
+			return err
+		}
+	}
+
+	image, err := h.imageService.UploadImage(r.Context(), file, header, inTx)
+	var predictErr *predictError
+	if errors.As(err, &predictErr) {
+		writePredictError(w, err)
+		return
+	}
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
@@ -55,11 +115,48 @@ func (h *UploadHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		OriginalName: image.OriginalName,
 		FileSize:     image.FileSize,
 		MimeType:     image.MimeType,
+		ContentHash:  image.ContentHash,
 		UploadedAt:   image.UploadedAt,
 		Message:      "Image uploaded successfully",
 	}
 
-	utils.WriteSuccessResponse(w, http.StatusCreated, response, "Image uploaded successfully")
+	if autoPredict {
+		// Without a queue the image is kept even if the prediction cannot
+		// be made, so the client can retry with POST /api/v1/predict/{image_id}.
+		var prediction *models.PredictionResponse
+		switch {
+		case inTx == nil:
+			job, prediction, err = h.predictions.predict(r.Context(), image, opts, force)
+		case cached != nil:
+			prediction, err = h.predictions.reusePrediction(r.Context(), cached, image)
+		}
+		if errors.As(err, &predictErr) && predictErr.retryAfter > 0 {
+			// The ML service is saturated: the client must back off, so
+			// the shed status is returned rather than a 201.
+			response.PredictionError = predictErr.message
+			response.Message = "Image uploaded, but the prediction was shed"
+			w.Header().Set("Retry-After", strconv.Itoa(int(predictErr.retryAfter/time.Second)))
+			utils.WriteErrorResponseWithDetails(w, predictErr.status, predictErr.message, response)
+			return
+		}
+		switch {
+		case err != nil:
+			response.PredictionError = err.Error()
+			response.Message = "Image uploaded, but the prediction failed"
+		case job != nil:
+			jobResponse := buildJobResponse(job)
+			response.Job = &jobResponse
+			response.Message = "Image uploaded and prediction job queued"
+		case prediction.Cached:
+			response.Prediction = prediction
+			response.Message = "Image uploaded, prediction reused from an identical image"
+		default:
+			response.Prediction = prediction
+			response.Message = "Image uploaded and prediction completed"
+		}
+	}
+
+	utils.WriteSuccessResponse(w, http.StatusCreated, response, response.Message)
 }
 
 func (h *UploadHandler) GetImage(w http.ResponseWriter, r *http.Request) {
@@ -80,7 +177,7 @@ func (h *UploadHandler) GetImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	imageID, _ := uuid.Parse(imageIDStr)
-	image, err := h.imageService.GetImageByID(imageID)
+	image, err := h.imageService.GetImageByID(r.Context(), imageID)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusNotFound, "Image not found")
 		return
@@ -92,6 +189,7 @@ func (h *UploadHandler) GetImage(w http.ResponseWriter, r *http.Request) {
 		OriginalName: image.OriginalName,
 		FileSize:     image.FileSize,
 		MimeType:     image.MimeType,
+		ContentHash:  image.ContentHash,
 		UploadedAt:   image.UploadedAt,
 	}
 
@@ -116,7 +214,7 @@ func (h *UploadHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	imageID, _ := uuid.Parse(imageIDStr)
-	err := h.imageService.DeleteImage(imageID)
+	err := h.imageService.DeleteImage(r.Context(), imageID)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to delete image")
 		return
@@ -1,10 +1,52 @@
 package middleware
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"strings"
 )
 
+type clientIDKey struct{}
+
+// ClientIdentityMiddleware resolves the client a request comes from for fair
+// job scheduling. A request carrying one of the configured client API keys
+// (Authorization: Bearer <key>) is attributed to that key's client; anything
+// else is attributed to the caller's address. Unknown keys are not rejected
+// here, since the same header carries the admin key on admin routes.
+func ClientIdentityMiddleware(clientKeys map[string]string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			client := ""
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				client = clientKeys[token]
+			}
+			if client == "" {
+				client = remoteHost(r)
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIDKey{}, client)))
+		}
+	}
+}
+
+// ClientID returns the client resolved by ClientIdentityMiddleware, or the
+// caller's address when the middleware did not run.
+func ClientID(r *http.Request) string {
+	if client, ok := r.Context().Value(clientIDKey{}).(string); ok {
+		return client
+	}
+	return remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func APIKeyAuthMiddleware(apiKey string) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,153 @@
+package mlfake
+
+import (
+	"car-status-backend/internal/mlpb"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService serves the scripted responses of a Server over gRPC.
+// Service-level failures (503, 429, 504, dropped connections) become gRPC
+// status errors; other scripted errors are per-image answers with
+// success = false, as in the real service.
+type grpcService struct {
+	mlpb.UnimplementedMLServiceServer
+	server *Server
+}
+
+// GRPCServer returns a gRPC server for s. It shares the script, health and
+// recorded requests with the HTTP handler.
+func (s *Server) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(16<<20),
+		grpc.MaxSendMsgSize(16<<20),
+	)
+	mlpb.RegisterMLServiceServer(srv, &grpcService{server: s})
+	return srv
+}
+
+// StartGRPC serves a fake on a local port over gRPC for tests. The returned
+// address is the endpoint URL to use with ML_SERVICE_TRANSPORT=grpc; call the
+// returned function to stop the server.
+func StartGRPC(script Script) (*Server, string, func()) {
+	s := NewServer(script)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mlfake: failed to listen: " + err.Error())
+	}
+
+	srv := s.GRPCServer()
+	go srv.Serve(listener)
+
+	return s, listener.Addr().String(), srv.Stop
+}
+
+func (g *grpcService) Health(ctx context.Context, req *mlpb.HealthRequest) (*mlpb.HealthResponse, error) {
+	g.server.mu.Lock()
+	healthy := g.server.healthy
+	g.server.mu.Unlock()
+
+	if !healthy {
+		return &mlpb.HealthResponse{Status: "unavailable", Service: "ml-service"}, nil
+	}
+	return &mlpb.HealthResponse{Status: "ok", Service: "ml-service"}, nil
+}
+
+func (g *grpcService) Predict(ctx context.Context, req *mlpb.PredictRequest) (*mlpb.PredictResponse, error) {
+	return g.predict(ctx, req)
+}
+
+func (g *grpcService) PredictStream(stream mlpb.MLService_PredictStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := g.predict(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *grpcService) predict(ctx context.Context, req *mlpb.PredictRequest) (*mlpb.PredictResponse, error) {
+	image := req.GetImagePath()
+	if image == "" {
+		image = req.GetFilename()
+	}
+	if req.GetImage() == nil {
+		return &mlpb.PredictResponse{
+			RequestId:  req.GetRequestId(),
+			Error:      "image_path or image_data is required",
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	response, checkFiles := g.server.next(image)
+	if checkFiles && response.StatusCode == http.StatusOK && req.GetImagePath() != "" {
+		if info, err := os.Stat(req.GetImagePath()); err != nil || info.IsDir() {
+			response = Response{StatusCode: http.StatusNotFound, Error: "Файл не найден по указанному пути"}
+		}
+	}
+
+	request := Request{Path: "grpc:/carstatus.ml.v1.MLService/Predict", Image: image, ModelVersion: req.GetModelVersion()}
+	if !g.server.wait(ctx, request, response) {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	switch {
+	case response.Drop:
+		return nil, status.Error(codes.Unavailable, "connection dropped")
+	case response.RawBody != "":
+		return nil, status.Error(codes.Internal, "raw bodies are only scripted over HTTP")
+	case response.StatusCode == http.StatusServiceUnavailable:
+		return nil, status.Error(codes.Unavailable, errorText(response))
+	case response.StatusCode == http.StatusTooManyRequests:
+		return nil, status.Error(codes.ResourceExhausted, errorText(response))
+	case response.StatusCode == http.StatusGatewayTimeout:
+		return nil, status.Error(codes.DeadlineExceeded, errorText(response))
+	case response.StatusCode != http.StatusOK:
+		return &mlpb.PredictResponse{
+			RequestId:  req.GetRequestId(),
+			Error:      errorText(response),
+			StatusCode: int32(response.StatusCode),
+		}, nil
+	}
+
+	modelVersion := response.ModelVersion
+	if req.GetModelVersion() != "" {
+		modelVersion = req.GetModelVersion()
+	}
+
+	return &mlpb.PredictResponse{
+		RequestId:        req.GetRequestId(),
+		Success:          true,
+		Cleanliness:      &mlpb.Label{Status: response.Cleanliness, Confidence: response.CleanlinessConfidence},
+		Integrity:        &mlpb.Label{Status: response.Integrity, Confidence: response.IntegrityConfidence},
+		ProcessingTimeMs: int32(response.ProcessingTimeMs),
+		ModelVersion:     modelVersion,
+	}, nil
+}
+
+func errorText(response Response) string {
+	if response.Error != "" {
+		return response.Error
+	}
+	return http.StatusText(response.StatusCode)
+}
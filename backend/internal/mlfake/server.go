@@ -0,0 +1,499 @@
+// Package mlfake is a stand-in for the Python ML service. It speaks the same
+// /api/predict, /api/predict/upload and /health contract, and the gRPC
+// MLService of proto/ml_service.proto, needs no model files, and answers with
+// scripted results, latencies and failures, so the backend can be run and
+// tested end to end without Python.
+package mlfake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response scripts one answer of the fake service. Zero fields fall back to
+// the server's default response.
+type Response struct {
+	// StatusCode is the HTTP status; anything but 200 is answered like
+	// FastAPI reports errors, with {"detail": Error}.
+	StatusCode int `json:"status_code,omitempty"`
+	// Delay is waited before answering, or until the request is cancelled.
+	Delay Duration `json:"delay,omitempty"`
+
+	Cleanliness           string  `json:"cleanliness,omitempty"`
+	CleanlinessConfidence float64 `json:"cleanliness_confidence,omitempty"`
+	Integrity             string  `json:"integrity,omitempty"`
+	IntegrityConfidence   float64 `json:"integrity_confidence,omitempty"`
+	ModelVersion          string  `json:"model_version,omitempty"`
+	ProcessingTimeMs      int     `json:"processing_time_ms,omitempty"`
+	Error                 string  `json:"error,omitempty"`
+
+	// RawBody is sent verbatim instead of a generated body, for malformed
+	// or out-of-schema responses.
+	RawBody string `json:"raw_body,omitempty"`
+	// Drop closes the connection without answering.
+	Drop bool `json:"drop,omitempty"`
+}
+
+// Rule answers with Response for images whose path or uploaded file name
+// contains Match.
+type Rule struct {
+	Match    string   `json:"match"`
+	Response Response `json:"response"`
+}
+
+// Script configures a Server. Queue is answered in order, one response per
+// prediction request, before Rules and Default are consulted. FailureRate
+// (0..1) turns that fraction of the remaining requests into FailureResponse.
+type Script struct {
+	Default         Response   `json:"default"`
+	Rules           []Rule     `json:"rules,omitempty"`
+	Queue           []Response `json:"queue,omitempty"`
+	FailureRate     float64    `json:"failure_rate,omitempty"`
+	FailureResponse Response   `json:"failure_response,omitempty"`
+	// CheckFiles answers 404 for image paths that do not exist, like the
+	// real service. It needs the backend's upload directory to be visible.
+	CheckFiles bool `json:"check_files,omitempty"`
+}
+
+// Request records a prediction request received by the fake service.
+type Request struct {
+	Path         string    `json:"path"`
+	Image        string    `json:"image"`
+	ModelVersion string    `json:"model_version,omitempty"`
+	StatusCode   int       `json:"status_code"`
+	ReceivedAt   time.Time `json:"received_at"`
+}
+
+// Server is the fake ML service. It is safe for concurrent use and can be
+// rescripted while it is serving.
+type Server struct {
+	mu       sync.Mutex
+	script   Script
+	healthy  bool
+	requests []Request
+	mux      *http.ServeMux
+}
+
+// DefaultResponse mirrors what ml/main.py returns for a clean, intact car.
+func DefaultResponse() Response {
+	return Response{
+		StatusCode:            http.StatusOK,
+		Cleanliness:           "clean",
+		CleanlinessConfidence: 0.85,
+		Integrity:             "intact",
+		IntegrityConfidence:   0.85,
+		ModelVersion:          "v1.0",
+		ProcessingTimeMs:      100,
+	}
+}
+
+// NewServer creates a fake service answering with script.
+func NewServer(script Script) *Server {
+	s := &Server{
+		script:  withDefaults(script),
+		healthy: true,
+		mux:     http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/health", s.handleHealth)
+	s.mux.HandleFunc("/api/predict", s.handlePredict)
+	s.mux.HandleFunc("/api/predict/upload", s.handleUpload)
+	s.mux.HandleFunc("/_fake/script", s.handleScript)
+	s.mux.HandleFunc("/_fake/queue", s.handleQueue)
+	s.mux.HandleFunc("/_fake/health", s.handleSetHealth)
+	s.mux.HandleFunc("/_fake/requests", s.handleRequests)
+
+	return s
+}
+
+// Start serves the fake on a local port for tests. The returned server's URL
+// is the ML_SERVICE_URL to use; Close it when done.
+func Start(script Script) (*Server, *httptest.Server) {
+	s := NewServer(script)
+	return s, httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetScript replaces the script and drops any queued responses.
+func (s *Server) SetScript(script Script) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.script = withDefaults(script)
+}
+
+// Enqueue appends responses to be returned, in order, by the next
+// prediction requests.
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.script.Queue = append(s.script.Queue, responses...)
+}
+
+// SetHealthy makes /health answer 200 or 503.
+func (s *Server) SetHealthy(healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.healthy = healthy
+}
+
+// Requests returns the prediction requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// Reset forgets the recorded requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	healthy := s.healthy
+	s.mu.Unlock()
+
+	if !healthy {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "service": "ml-service"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "service": "ml-service"})
+}
+
+func (s *Server) handlePredict(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeDetail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	var body struct {
+		ImagePath    string `json:"image_path"`
+		ModelVersion string `json:"model_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ImagePath == "" {
+		writeDetail(w, http.StatusUnprocessableEntity, "image_path is required")
+		return
+	}
+
+	response, checkFiles := s.next(body.ImagePath)
+	if checkFiles && response.StatusCode == http.StatusOK {
+		if info, err := os.Stat(body.ImagePath); err != nil || info.IsDir() {
+			response = Response{StatusCode: http.StatusNotFound, Error: "Файл не найден по указанному пути"}
+		}
+	}
+
+	s.answer(w, r, Request{Path: r.URL.Path, Image: body.ImagePath, ModelVersion: body.ModelVersion}, response)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeDetail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeDetail(w, http.StatusUnprocessableEntity, "file is required")
+		return
+	}
+	file.Close()
+
+	response, _ := s.next(header.Filename)
+	s.answer(w, r, Request{Path: r.URL.Path, Image: header.Filename, ModelVersion: r.FormValue("model_version")}, response)
+}
+
+// next picks the response for image: the head of the queue, else a random
+// failure, else the first matching rule, else the default.
+func (s *Server) next(image string) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.script.Queue) > 0 {
+		response := s.script.Queue[0]
+		s.script.Queue = s.script.Queue[1:]
+		return merge(response, s.script.Default), s.script.CheckFiles
+	}
+
+	if s.script.FailureRate > 0 && rand.Float64() < s.script.FailureRate {
+		return merge(s.script.FailureResponse, s.script.Default), s.script.CheckFiles
+	}
+
+	name := filepath.Base(image)
+	for _, rule := range s.script.Rules {
+		if strings.Contains(image, rule.Match) || strings.Contains(name, rule.Match) {
+			return merge(rule.Response, s.script.Default), s.script.CheckFiles
+		}
+	}
+
+	return s.script.Default, s.script.CheckFiles
+}
+
+// wait records request and sleeps for the scripted delay. It returns false
+// if the caller went away in the meantime.
+func (s *Server) wait(ctx context.Context, request Request, response Response) bool {
+	request.StatusCode = response.StatusCode
+	request.ReceivedAt = time.Now()
+	if response.Drop {
+		request.StatusCode = 0
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+
+	if response.Delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(time.Duration(response.Delay))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (s *Server) answer(w http.ResponseWriter, r *http.Request, request Request, response Response) {
+	if !s.wait(r.Context(), request, response) {
+		return
+	}
+
+	if response.Drop {
+		drop(w)
+		return
+	}
+
+	if response.RawBody != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(response.StatusCode)
+		w.Write([]byte(response.RawBody))
+		return
+	}
+
+	if response.StatusCode != http.StatusOK {
+		writeDetail(w, response.StatusCode, response.Error)
+		return
+	}
+
+	modelVersion := response.ModelVersion
+	if request.ModelVersion != "" {
+		modelVersion = request.ModelVersion
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"cleanliness": map[string]interface{}{
+			"status":     response.Cleanliness,
+			"confidence": response.CleanlinessConfidence,
+		},
+		"integrity": map[string]interface{}{
+			"status":     response.Integrity,
+			"confidence": response.IntegrityConfidence,
+		},
+		"processing_time_ms": response.ProcessingTimeMs,
+		"model_version":      modelVersion,
+		"success":            true,
+	})
+}
+
+// handleScript replaces the script (PUT/POST) or returns it (GET).
+func (s *Server) handleScript(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		script := s.script
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, script)
+	case http.MethodPost, http.MethodPut:
+		var script Script
+		if err := json.NewDecoder(r.Body).Decode(&script); err != nil {
+			writeDetail(w, http.StatusBadRequest, "invalid script: "+err.Error())
+			return
+		}
+		s.SetScript(script)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeDetail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// handleQueue appends a JSON array of responses to the queue.
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeDetail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	var responses []Response
+	if err := json.NewDecoder(r.Body).Decode(&responses); err != nil {
+		writeDetail(w, http.StatusBadRequest, "expected a JSON array of responses: "+err.Error())
+		return
+	}
+	s.Enqueue(responses...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetHealth sets the /health answer from {"healthy": bool}.
+func (s *Server) handleSetHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeDetail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	var body struct {
+		Healthy bool `json:"healthy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeDetail(w, http.StatusBadRequest, "expected {\"healthy\": true|false}")
+		return
+	}
+	s.SetHealthy(body.Healthy)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRequests lists (GET) or forgets (DELETE) the recorded requests.
+func (s *Server) handleRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.Requests())
+	case http.MethodDelete:
+		s.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeDetail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// LoadScript reads a Script from a JSON file.
+func LoadScript(path string) (Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Script{}, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return Script{}, fmt.Errorf("failed to parse script: %w", err)
+	}
+
+	return script, nil
+}
+
+func withDefaults(script Script) Script {
+	script.Default = merge(script.Default, DefaultResponse())
+	if script.FailureResponse == (Response{}) {
+		script.FailureResponse = Response{StatusCode: http.StatusServiceUnavailable, Error: "fake failure"}
+	}
+	return script
+}
+
+// merge fills the zero fields of response from fallback. A response that
+// scripts a raw body or a dropped connection is used as is.
+func merge(response, fallback Response) Response {
+	if response.RawBody != "" || response.Drop {
+		if response.StatusCode == 0 {
+			response.StatusCode = http.StatusOK
+		}
+		return response
+	}
+
+	if response.StatusCode == 0 {
+		response.StatusCode = fallback.StatusCode
+	}
+	if response.Delay == 0 {
+		response.Delay = fallback.Delay
+	}
+	if response.Cleanliness == "" {
+		response.Cleanliness = fallback.Cleanliness
+	}
+	if response.CleanlinessConfidence == 0 {
+		response.CleanlinessConfidence = fallback.CleanlinessConfidence
+	}
+	if response.Integrity == "" {
+		response.Integrity = fallback.Integrity
+	}
+	if response.IntegrityConfidence == 0 {
+		response.IntegrityConfidence = fallback.IntegrityConfidence
+	}
+	if response.ModelVersion == "" {
+		response.ModelVersion = fallback.ModelVersion
+	}
+	if response.ProcessingTimeMs == 0 {
+		response.ProcessingTimeMs = fallback.ProcessingTimeMs
+	}
+	if response.Error == "" {
+		response.Error = fallback.Error
+	}
+	return response
+}
+
+func drop(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	conn.Close()
+}
+
+func writeDetail(w http.ResponseWriter, statusCode int, detail string) {
+	if detail == "" {
+		detail = http.StatusText(statusCode)
+	}
+	writeJSON(w, statusCode, map[string]string{"detail": detail})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Duration is a time.Duration that reads and writes JSON as "250ms".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errors.New("duration must be a string such as \"250ms\"")
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,5 @@
+// Package mlpb holds the Go code generated from proto/ml_service.proto, the
+// gRPC contract of the ML service.
+package mlpb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ml_service.proto
@@ -0,0 +1,227 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: ml_service.proto
+
+// Контракт ML сервиса для транспорта gRPC (ML_SERVICE_TRANSPORT=grpc).
+// Повторяет JSON API /api/predict и /health и добавляет потоковый пакетный анализ.
+
+package mlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	MLService_Predict_FullMethodName       = "/carstatus.ml.v1.MLService/Predict"
+	MLService_PredictStream_FullMethodName = "/carstatus.ml.v1.MLService/PredictStream"
+	MLService_Health_FullMethodName        = "/carstatus.ml.v1.MLService/Health"
+)
+
+// MLServiceClient is the client API for MLService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MLServiceClient interface {
+	// Анализ одного изображения.
+	Predict(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (*PredictResponse, error)
+	// Пакетный анализ по одному долгоживущему потоку: клиент отправляет
+	// запросы, сервис отвечает на каждый по мере готовности (порядок не гарантирован,
+	// ответы сопоставляются по request_id). Ошибка одного изображения не обрывает поток.
+	PredictStream(ctx context.Context, opts ...grpc.CallOption) (MLService_PredictStreamClient, error)
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+}
+
+type mLServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMLServiceClient(cc grpc.ClientConnInterface) MLServiceClient {
+	return &mLServiceClient{cc}
+}
+
+func (c *mLServiceClient) Predict(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (*PredictResponse, error) {
+	out := new(PredictResponse)
+	err := c.cc.Invoke(ctx, MLService_Predict_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mLServiceClient) PredictStream(ctx context.Context, opts ...grpc.CallOption) (MLService_PredictStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MLService_ServiceDesc.Streams[0], MLService_PredictStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &mLServicePredictStreamClient{stream}
+	return x, nil
+}
+
+type MLService_PredictStreamClient interface {
+	Send(*PredictRequest) error
+	Recv() (*PredictResponse, error)
+	grpc.ClientStream
+}
+
+type mLServicePredictStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *mLServicePredictStreamClient) Send(m *PredictRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *mLServicePredictStreamClient) Recv() (*PredictResponse, error) {
+	m := new(PredictResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *mLServiceClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, MLService_Health_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MLServiceServer is the server API for MLService service.
+// All implementations must embed UnimplementedMLServiceServer
+// for forward compatibility
+type MLServiceServer interface {
+	// Анализ одного изображения.
+	Predict(context.Context, *PredictRequest) (*PredictResponse, error)
+	// Пакетный анализ по одному долгоживущему потоку: клиент отправляет
+	// запросы, сервис отвечает на каждый по мере готовности (порядок не гарантирован,
+	// ответы сопоставляются по request_id). Ошибка одного изображения не обрывает поток.
+	PredictStream(MLService_PredictStreamServer) error
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	mustEmbedUnimplementedMLServiceServer()
+}
+
+// UnimplementedMLServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMLServiceServer struct {
+}
+
+func (UnimplementedMLServiceServer) Predict(context.Context, *PredictRequest) (*PredictResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Predict not implemented")
+}
+func (UnimplementedMLServiceServer) PredictStream(MLService_PredictStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method PredictStream not implemented")
+}
+func (UnimplementedMLServiceServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (UnimplementedMLServiceServer) mustEmbedUnimplementedMLServiceServer() {}
+
+// UnsafeMLServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MLServiceServer will
+// result in compilation errors.
+type UnsafeMLServiceServer interface {
+	mustEmbedUnimplementedMLServiceServer()
+}
+
+func RegisterMLServiceServer(s grpc.ServiceRegistrar, srv MLServiceServer) {
+	s.RegisterService(&MLService_ServiceDesc, srv)
+}
+
+func _MLService_Predict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PredictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MLServiceServer).Predict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MLService_Predict_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MLServiceServer).Predict(ctx, req.(*PredictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MLService_PredictStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MLServiceServer).PredictStream(&mLServicePredictStreamServer{stream})
+}
+
+type MLService_PredictStreamServer interface {
+	Send(*PredictResponse) error
+	Recv() (*PredictRequest, error)
+	grpc.ServerStream
+}
+
+type mLServicePredictStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *mLServicePredictStreamServer) Send(m *PredictResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *mLServicePredictStreamServer) Recv() (*PredictRequest, error) {
+	m := new(PredictRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _MLService_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MLServiceServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MLService_Health_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MLServiceServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MLService_ServiceDesc is the grpc.ServiceDesc for MLService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MLService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "carstatus.ml.v1.MLService",
+	HandlerType: (*MLServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Predict",
+			Handler:    _MLService_Predict_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _MLService_Health_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PredictStream",
+			Handler:       _MLService_PredictStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ml_service.proto",
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PredictionBatch struct {
+	ID         uuid.UUID       `json:"id" db:"id"`
+	ClientID   string          `json:"client_id,omitempty" db:"client_id"`
+	Priority   int             `json:"priority" db:"priority"`
+	Filter     json.RawMessage `json:"filter,omitempty" db:"filter"`
+	TotalItems int             `json:"total_items" db:"total_items"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// BatchFilter selects images for a batch instead of listing their IDs.
+type BatchFilter struct {
+	UploadedToday     bool       `json:"uploaded_today,omitempty"`
+	UploadedAfter     *time.Time `json:"uploaded_after,omitempty"`
+	UploadedBefore    *time.Time `json:"uploaded_before,omitempty"`
+	WithoutPrediction bool       `json:"without_prediction,omitempty"`
+}
+
+// BatchPredictRequest is the JSON body of POST /api/v1/predict/batch. Exactly
+// one of ImageIDs and Filter has to be set.
+type BatchPredictRequest struct {
+	ImageIDs []uuid.UUID  `json:"image_ids,omitempty"`
+	Filter   *BatchFilter `json:"filter,omitempty"`
+	Priority string       `json:"priority,omitempty"`
+}
+
+type BatchItem struct {
+	ImageID      uuid.UUID           `json:"image_id"`
+	JobID        *uuid.UUID          `json:"job_id,omitempty"`
+	Status       string              `json:"status"`
+	PredictionID *uuid.UUID          `json:"prediction_id,omitempty"`
+	Prediction   *PredictionResponse `json:"prediction,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+type BatchProgress struct {
+	Pending    int     `json:"pending"`
+	Processing int     `json:"processing"`
+	Completed  int     `json:"completed"`
+	Failed     int     `json:"failed"`
+	DeadLetter int     `json:"dead_letter"`
+	Cancelled  int     `json:"cancelled"`
+	Done       int     `json:"done"`
+	Percent    float64 `json:"percent"`
+}
+
+type BatchResponse struct {
+	ID        uuid.UUID     `json:"id"`
+	Status    string        `json:"status"`
+	Total     int           `json:"total"`
+	Priority  int           `json:"priority"`
+	Progress  BatchProgress `json:"progress"`
+	Items     []BatchItem   `json:"items"`
+	Rejected  []BatchItem   `json:"rejected,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	Message   string        `json:"message,omitempty"`
+}
@@ -13,6 +13,7 @@ type CarImage struct {
 	FilePath     string    `json:"file_path" db:"file_path"`
 	FileSize     int64     `json:"file_size" db:"file_size"`
 	MimeType     string    `json:"mime_type" db:"mime_type"`
+	ContentHash  string    `json:"content_hash" db:"content_hash"`
 	UploadedAt   time.Time `json:"uploaded_at" db:"uploaded_at"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
@@ -27,6 +28,14 @@ type CarImageResponse struct {
 	OriginalName string    `json:"original_name"`
 	FileSize     int64     `json:"file_size"`
 	MimeType     string    `json:"mime_type"`
+	ContentHash  string    `json:"content_hash,omitempty"`
 	UploadedAt   time.Time `json:"uploaded_at"`
 	Message      string    `json:"message,omitempty"`
+
+	// Set on upload with auto_predict: the finished prediction when the
+	// queue is disabled, the queued job otherwise, or the reason the
+	// prediction could not be started.
+	Prediction      *PredictionResponse    `json:"prediction,omitempty"`
+	Job             *PredictionJobResponse `json:"job,omitempty"`
+	PredictionError string                 `json:"prediction_error,omitempty"`
 }
\ No newline at end of file
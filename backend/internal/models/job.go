@@ -7,16 +7,23 @@ import (
 )
 
 type PredictionJob struct {
-	ID           uuid.UUID  `json:"id" db:"id"`
-	ImageID      uuid.UUID  `json:"image_id" db:"image_id"`
-	Status       string     `json:"status" db:"status"`
-	RetryCount   int        `json:"retry_count" db:"retry_count"`
-	MaxRetries   int        `json:"max_retries" db:"max_retries"`
-	ScheduledAt  time.Time  `json:"scheduled_at" db:"scheduled_at"`
-	StartedAt    *time.Time `json:"started_at" db:"started_at"`
-	CompletedAt  *time.Time `json:"completed_at" db:"completed_at"`
-	ErrorMessage string     `json:"error_message" db:"error_message"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	ImageID         uuid.UUID  `json:"image_id" db:"image_id"`
+	Status          string     `json:"status" db:"status"`
+	RetryCount      int        `json:"retry_count" db:"retry_count"`
+	MaxRetries      int        `json:"max_retries" db:"max_retries"`
+	ScheduledAt     time.Time  `json:"scheduled_at" db:"scheduled_at"`
+	StartedAt       *time.Time `json:"started_at" db:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at" db:"completed_at"`
+	ErrorMessage    string     `json:"error_message" db:"error_message"`
+	PredictionID    *uuid.UUID `json:"prediction_id" db:"prediction_id"`
+	LockedBy        string     `json:"locked_by,omitempty" db:"locked_by"`
+	LeaseExpiresAt  *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
+	Priority        int        `json:"priority" db:"priority"`
+	ClientID        string     `json:"client_id,omitempty" db:"client_id"`
+	CancelRequested bool       `json:"cancel_requested" db:"cancel_requested"`
+	BatchID         *uuid.UUID `json:"batch_id,omitempty" db:"batch_id"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 }
 
 type JobStatus string
@@ -26,20 +33,66 @@ const (
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
+	JobStatusDeadLetter JobStatus = "dead_letter"
+	JobStatusCancelled  JobStatus = "cancelled"
 )
 
+// Job priorities run from JobPriorityLow to JobPriorityHigh; higher values are
+// claimed first.
+const (
+	JobPriorityLow    = 0
+	JobPriorityNormal = 5
+	JobPriorityHigh   = 10
+)
+
+// PredictOptions is the optional JSON body of POST /api/v1/predict/{image_id}.
+// Priority is "low", "normal", "high" or a number from 0 to 10.
+type PredictOptions struct {
+	Priority string `json:"priority,omitempty"`
+}
+
+// JobUpdateRequest is the JSON body of PATCH /api/v1/jobs/{id}. Omitted fields
+// are left unchanged.
+type JobUpdateRequest struct {
+	Priority    *string    `json:"priority,omitempty"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+}
+
+// JobUpdate changes a pending job. Nil fields are left unchanged.
+type JobUpdate struct {
+	Priority    *int
+	ScheduledAt *time.Time
+}
+
+// JobOptions are the caller-supplied settings of a new job.
+type JobOptions struct {
+	Priority int
+	ClientID string
+	BatchID  *uuid.UUID
+}
+
 type PredictionJobRequest struct {
+	JobID     uuid.UUID `json:"job_id"`
 	ImageID   uuid.UUID `json:"image_id"`
-	ImagePath string    `json:"image_path"`
+	ImagePath string    `json:"image_path,omitempty"`
+	Priority  int       `json:"priority"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
 type PredictionJobResponse struct {
-	ID          uuid.UUID  `json:"id"`
-	ImageID     uuid.UUID  `json:"image_id"`
-	Status      string     `json:"status"`
-	RetryCount  int        `json:"retry_count"`
-	CreatedAt   time.Time  `json:"created_at"`
-	CompletedAt *time.Time `json:"completed_at,omitempty"`
-	Message     string     `json:"message,omitempty"`
+	ID              uuid.UUID  `json:"id"`
+	ImageID         uuid.UUID  `json:"image_id"`
+	Status          string     `json:"status"`
+	RetryCount      int        `json:"retry_count"`
+	MaxRetries      int        `json:"max_retries"`
+	Priority        int        `json:"priority"`
+	ClientID        string     `json:"client_id,omitempty"`
+	CancelRequested bool       `json:"cancel_requested,omitempty"`
+	ErrorMessage    string     `json:"error_message,omitempty"`
+	PredictionID    *uuid.UUID `json:"prediction_id,omitempty"`
+	ScheduledAt     time.Time  `json:"scheduled_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	Message         string     `json:"message,omitempty"`
 }
\ No newline at end of file
@@ -16,9 +16,11 @@ type Prediction struct {
 	IntegrityConfidence   float64         `json:"integrity_confidence" db:"integrity_confidence"`
 	ProcessingTimeMs      int             `json:"processing_time_ms" db:"processing_time_ms"`
 	MLModelVersion        string          `json:"ml_model_version" db:"ml_model_version"`
+	MLVariant             string          `json:"ml_variant" db:"ml_variant"`
 	AdditionalData        json.RawMessage `json:"additional_data" db:"additional_data"`
 	Status                string          `json:"status" db:"status"`
 	ErrorMessage          string          `json:"error_message" db:"error_message"`
+	FailureReason         string          `json:"failure_reason" db:"failure_reason"`
 	CreatedAt             time.Time       `json:"created_at" db:"created_at"`
 	CompletedAt           *time.Time      `json:"completed_at" db:"completed_at"`
 }
@@ -38,12 +40,16 @@ type PredictionResponse struct {
 		Status     string  `json:"status"`
 		Confidence float64 `json:"confidence"`
 	} `json:"integrity"`
-	ProcessingTimeMs int       `json:"processing_time_ms"`
-	ModelVersion     string    `json:"model_version"`
-	Status           string    `json:"status"`
-	CreatedAt        time.Time `json:"created_at"`
+	ProcessingTimeMs int        `json:"processing_time_ms"`
+	ModelVersion     string     `json:"model_version"`
+	Variant          string     `json:"variant,omitempty"`
+	Status           string     `json:"status"`
+	Error            string     `json:"error,omitempty"`
+	FailureReason    string     `json:"failure_reason,omitempty"`
+	Cached           bool       `json:"cached,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
 	CompletedAt      *time.Time `json:"completed_at,omitempty"`
-	Message          string    `json:"message,omitempty"`
+	Message          string     `json:"message,omitempty"`
 }
 
 type MLPredictionRequest struct {
@@ -64,4 +70,7 @@ type MLPredictionResponse struct {
 	ModelVersion   string `json:"model_version"`
 	Success        bool   `json:"success"`
 	Error          string `json:"error,omitempty"`
+	StatusCode     int    `json:"-"`
+	Variant        string `json:"-"`
+	FailureReason  string `json:"-"`
 }
\ No newline at end of file
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShadowPrediction is the output of a candidate model for an image that was
+// also predicted by a primary model. It is never returned as the result of a
+// prediction request.
+type ShadowPrediction struct {
+	ID                    uuid.UUID `json:"id" db:"id"`
+	PredictionID          uuid.UUID `json:"prediction_id" db:"prediction_id"`
+	ImageID               uuid.UUID `json:"image_id" db:"image_id"`
+	MLVariant             string    `json:"ml_variant" db:"ml_variant"`
+	MLModelVersion        string    `json:"ml_model_version" db:"ml_model_version"`
+	CleanlinessStatus     string    `json:"cleanliness_status" db:"cleanliness_status"`
+	CleanlinessConfidence float64   `json:"cleanliness_confidence" db:"cleanliness_confidence"`
+	IntegrityStatus       string    `json:"integrity_status" db:"integrity_status"`
+	IntegrityConfidence   float64   `json:"integrity_confidence" db:"integrity_confidence"`
+	ProcessingTimeMs      int       `json:"processing_time_ms" db:"processing_time_ms"`
+	Status                string    `json:"status" db:"status"`
+	ErrorMessage          string    `json:"error_message" db:"error_message"`
+	CreatedAt             time.Time `json:"created_at" db:"created_at"`
+}
+
+// ShadowAgreement compares one shadow model with the primary predictions it
+// mirrored. Match rates are fractions (0..1) of completed shadow predictions
+// that gave the same status as the primary one; confidence deltas are shadow
+// minus primary.
+type ShadowAgreement struct {
+	Variant                       string   `json:"variant" db:"ml_variant"`
+	ModelVersion                  string   `json:"model_version" db:"ml_model_version"`
+	Total                         int      `json:"total" db:"total"`
+	Completed                     int      `json:"completed" db:"completed"`
+	Failed                        int      `json:"failed" db:"failed"`
+	CleanlinessMatchRate          *float64 `json:"cleanliness_match_rate" db:"cleanliness_match_rate"`
+	IntegrityMatchRate            *float64 `json:"integrity_match_rate" db:"integrity_match_rate"`
+	FullMatchRate                 *float64 `json:"full_match_rate" db:"full_match_rate"`
+	AvgCleanlinessConfidenceDelta *float64 `json:"avg_cleanliness_confidence_delta" db:"avg_cleanliness_confidence_delta"`
+	AvgIntegrityConfidenceDelta   *float64 `json:"avg_integrity_confidence_delta" db:"avg_integrity_confidence_delta"`
+	AvgProcessingTimeMs           *float64 `json:"avg_processing_time_ms" db:"avg_processing_time_ms"`
+	AvgPrimaryProcessingTimeMs    *float64 `json:"avg_primary_processing_time_ms" db:"avg_primary_processing_time_ms"`
+}
+
+type ShadowReport struct {
+	Hours    int               `json:"hours"`
+	Variants []ShadowAgreement `json:"variants"`
+}
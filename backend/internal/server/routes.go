@@ -10,6 +10,7 @@ type Handlers struct {
 	Health     *handlers.HealthHandler
 	Upload     *handlers.UploadHandler
 	Prediction *handlers.PredictionHandler
+	Job        *handlers.JobHandler
 	Swagger    *handlers.SwaggerHandler
 }
 
@@ -17,13 +18,20 @@ func NewHandlers(
 	imageService *services.ImageService,
 	predictionService *services.PredictionService,
 	mlClient *services.MLClient,
-	queueService *services.QueueService,
+	queueService services.Queue,
+	batchService *services.BatchService,
+	shadowService *services.ShadowService,
+	mlLimiter *services.MLLimiter,
+	autoPredict bool,
 	db interface{},
 ) *Handlers {
+	prediction := handlers.NewPredictionHandler(imageService, predictionService, mlClient, queueService, batchService, shadowService, mlLimiter)
+
 	return &Handlers{
 		Health:     handlers.NewHealthHandler(db.(*database.DB), mlClient),
-		Upload:     handlers.NewUploadHandler(imageService),
-		Prediction: handlers.NewPredictionHandler(imageService, predictionService, mlClient, queueService),
+		Upload:     handlers.NewUploadHandler(imageService, prediction, autoPredict),
+		Prediction: prediction,
+		Job:        handlers.NewJobHandler(queueService),
 		Swagger:    handlers.NewSwaggerHandler("./api/openapi.yaml"),
 	}
 }
\ No newline at end of file
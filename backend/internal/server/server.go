@@ -4,6 +4,7 @@ import (
 	"car-status-backend/internal/middleware"
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,11 +13,13 @@ import (
 )
 
 type Server struct {
-	httpServer *http.Server
-	router     *http.ServeMux
+	httpServer    *http.Server
+	router        *http.ServeMux
+	adminAPIKey   string
+	clientAPIKeys map[string]string
 }
 
-func NewServer(addr string) *Server {
+func NewServer(addr string, adminAPIKey string, clientAPIKeys map[string]string) *Server {
 	mux := http.NewServeMux()
 
 	server := &http.Server{
@@ -27,9 +30,20 @@ func NewServer(addr string) *Server {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Request contexts derive from baseCtx, which is cancelled as soon as
+	// shutdown starts, so in-flight ML calls are aborted instead of holding
+	// the shutdown up for the full ML timeout.
+	baseCtx, cancel := context.WithCancel(context.Background())
+	server.BaseContext = func(net.Listener) context.Context {
+		return baseCtx
+	}
+	server.RegisterOnShutdown(cancel)
+
 	return &Server{
-		httpServer: server,
-		router:     mux,
+		httpServer:    server,
+		router:        mux,
+		adminAPIKey:   adminAPIKey,
+		clientAPIKeys: clientAPIKeys,
 	}
 }
 
@@ -44,9 +58,24 @@ func (s *Server) RegisterRoutes(handlers *Handlers) {
 	s.router.HandleFunc("/api/v1/images/", s.withMiddleware(handlers.Upload.GetImage))
 
 	// Prediction endpoints
+	s.router.HandleFunc("/api/v1/predict/batch", s.withMiddleware(handlers.Prediction.PredictBatch))
 	s.router.HandleFunc("/api/v1/predict/", s.withMiddleware(handlers.Prediction.PredictImage))
+	s.router.HandleFunc("/api/v1/batches/", s.withMiddleware(handlers.Prediction.GetBatch))
 	s.router.HandleFunc("/api/v1/predictions/", s.withMiddleware(handlers.Prediction.GetPrediction))
 	s.router.HandleFunc("/api/v1/predictions/stats", s.withMiddleware(handlers.Prediction.GetPredictionStats))
+	s.router.HandleFunc("/api/v1/predictions/shadow/report", s.withMiddleware(handlers.Prediction.GetShadowReport))
+
+	// Job endpoints
+	s.router.HandleFunc("/api/v1/jobs/stats", s.withMiddleware(handlers.Job.GetJobStats))
+	s.router.HandleFunc("/api/v1/jobs/", s.withMiddleware(handlers.Job.HandleJob))
+
+	// Admin endpoints are only served behind a configured API key
+	if s.adminAPIKey != "" {
+		s.router.HandleFunc("/api/v1/admin/jobs/dead-letter", s.withAdminMiddleware(handlers.Job.ListDeadLetterJobs))
+		s.router.HandleFunc("/api/v1/admin/jobs/dead-letter/", s.withAdminMiddleware(handlers.Job.DeadLetterJob))
+	} else {
+		log.Println("ADMIN_API_KEY is not set, admin endpoints are disabled")
+	}
 
 	// API Documentation endpoints
 	s.router.HandleFunc("/api/docs", s.withMiddleware(handlers.Swagger.ApiDocsIndex))
@@ -63,12 +92,18 @@ func (s *Server) withMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return middleware.CORSMiddleware(
 		middleware.LoggingMiddleware(
 			middleware.RecoveryMiddleware(
-				middleware.JSONMiddleware(next),
+				middleware.ClientIdentityMiddleware(s.clientAPIKeys)(
+					middleware.JSONMiddleware(next),
+				),
 			),
 		),
 	)
 }
 
+func (s *Server) withAdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.withMiddleware(middleware.APIKeyAuthMiddleware(s.adminAPIKey)(next))
+}
+
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
@@ -94,8 +129,15 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 			"upload": "/api/v1/images/upload",
 			"get_image": "/api/v1/images/{id}",
 			"predict": "/api/v1/predict/{image_id}",
+			"predict_batch": "/api/v1/predict/batch",
+			"get_batch": "/api/v1/batches/{id}",
 			"get_prediction": "/api/v1/predictions/{id}",
-			"prediction_stats": "/api/v1/predictions/stats"
+			"prediction_stats": "/api/v1/predictions/stats",
+			"shadow_report": "/api/v1/predictions/shadow/report",
+			"get_job": "/api/v1/jobs/{id}",
+			"cancel_job": "DELETE /api/v1/jobs/{id}",
+			"update_job": "PATCH /api/v1/jobs/{id}",
+			"job_stats": "/api/v1/jobs/stats"
 		}
 	}`
 
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrBatchNotFound = errors.New("batch not found")
+
+// BatchService fans a batch prediction request out to one queue job per
+// image. The batch row only records who asked for what; progress is always
+// read back from the jobs themselves.
+type BatchService struct {
+	db      *database.DB
+	queue   Queue
+	maxSize int
+}
+
+func NewBatchService(db *database.DB, queue Queue, maxSize int) *BatchService {
+	return &BatchService{
+		db:      db,
+		queue:   queue,
+		maxSize: maxSize,
+	}
+}
+
+// MaxSize is the largest number of images a single batch may contain.
+func (s *BatchService) MaxSize() int {
+	return s.maxSize
+}
+
+// CreateBatch records the batch and publishes a job for every image in one
+// transaction, so a batch is either queued in full or not created at all.
+func (s *BatchService) CreateBatch(ctx context.Context, images []models.CarImage, filter *models.BatchFilter, opts models.JobOptions) (*models.PredictionBatch, []models.PredictionJob, error) {
+	if len(images) == 0 {
+		return nil, nil, fmt.Errorf("failed to create batch: no images")
+	}
+
+	batch := &models.PredictionBatch{
+		ID:         uuid.New(),
+		ClientID:   opts.ClientID,
+		Priority:   opts.Priority,
+		TotalItems: len(images),
+		CreatedAt:  time.Now(),
+	}
+
+	if filter != nil {
+		filterJSON, err := json.Marshal(filter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal batch filter: %w", err)
+		}
+		batch.Filter = filterJSON
+	}
+
+	opts.BatchID = &batch.ID
+
+	jobs := make([]models.PredictionJob, 0, len(images))
+	err := s.db.WithTx(func(tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO prediction_batches (id, client_id, priority, filter, total_items, created_at)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+		`
+
+		_, err := tx.ExecContext(ctx, query,
+			batch.ID,
+			batch.ClientID,
+			batch.Priority,
+			nullableJSON(batch.Filter),
+			batch.TotalItems,
+			batch.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create batch: %w", err)
+		}
+
+		for _, image := range images {
+			job, err := s.queue.PublishTx(tx, image.ID, image.FilePath, opts)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, *job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return batch, jobs, nil
+}
+
+// GetBatch returns the batch together with the current state of its jobs.
+func (s *BatchService) GetBatch(ctx context.Context, id uuid.UUID) (*models.PredictionBatch, []models.PredictionJob, error) {
+	var batch models.PredictionBatch
+	query := `
+		SELECT id, COALESCE(client_id, '') AS client_id, priority, filter, total_items, created_at
+		FROM prediction_batches
+		WHERE id = $1
+	`
+
+	err := s.db.GetContext(ctx, &batch, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrBatchNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	jobs, err := s.queue.ListByBatch(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &batch, jobs, nil
+}
+
+func nullableJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return []byte(data)
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBatchServiceCreatesBatchWithJobs(t *testing.T) {
+	db := testDB(t)
+	queue := NewDBQueue(3, RetryPolicy{}, "", "", db)
+	service := NewBatchService(db, queue, 10)
+
+	images := []models.CarImage{
+		{ID: insertImage(t, db, ""), FilePath: "/uploads/a.jpg"},
+		{ID: insertImage(t, db, ""), FilePath: "/uploads/b.jpg"},
+	}
+	filter := &models.BatchFilter{WithoutPrediction: true}
+	opts := models.JobOptions{Priority: models.JobPriorityLow, ClientID: "archive"}
+
+	batch, jobs, err := service.CreateBatch(context.Background(), images, filter, opts)
+	if err != nil {
+		t.Fatalf("CreateBatch: %v", err)
+	}
+	if batch.TotalItems != 2 || len(jobs) != 2 {
+		t.Fatalf("batch of %d items with %d jobs, want 2 and 2", batch.TotalItems, len(jobs))
+	}
+	for i, job := range jobs {
+		if job.ImageID != images[i].ID || job.BatchID == nil || *job.BatchID != batch.ID {
+			t.Errorf("job %d is for image %s in batch %v, want image %s in batch %s", i, job.ImageID, job.BatchID, images[i].ID, batch.ID)
+		}
+		if job.Priority != models.JobPriorityLow || job.ClientID != "archive" {
+			t.Errorf("job %d has priority %d and client %q, want the batch options", i, job.Priority, job.ClientID)
+		}
+	}
+
+	stored, storedJobs, err := service.GetBatch(context.Background(), batch.ID)
+	if err != nil {
+		t.Fatalf("GetBatch: %v", err)
+	}
+	if stored.ClientID != "archive" || stored.TotalItems != 2 || len(stored.Filter) == 0 {
+		t.Errorf("stored batch = %+v, want the created batch with its filter", stored)
+	}
+	if len(storedJobs) != 2 {
+		t.Errorf("GetBatch returned %d jobs, want 2", len(storedJobs))
+	}
+
+	if _, _, err := service.GetBatch(context.Background(), uuid.New()); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("GetBatch of an unknown batch = %v, want ErrBatchNotFound", err)
+	}
+}
+
+func TestBatchServiceCreatesNothingWhenAJobFails(t *testing.T) {
+	db := testDB(t)
+	queue := NewDBQueue(3, RetryPolicy{}, "", "", db)
+	service := NewBatchService(db, queue, 10)
+
+	// The second image has no row, so its job violates the foreign key.
+	images := []models.CarImage{
+		{ID: insertImage(t, db, "")},
+		{ID: uuid.New()},
+	}
+	clientID := "client-" + uuid.NewString()
+
+	if _, _, err := service.CreateBatch(context.Background(), images, nil, models.JobOptions{ClientID: clientID}); err == nil {
+		t.Fatal("CreateBatch succeeded with a missing image")
+	}
+
+	var batches, jobs int
+	if err := db.Get(&batches, `SELECT COUNT(*) FROM prediction_batches WHERE client_id = $1`, clientID); err != nil {
+		t.Fatalf("count batches: %v", err)
+	}
+	if err := db.Get(&jobs, `SELECT COUNT(*) FROM prediction_jobs WHERE client_id = $1`, clientID); err != nil {
+		t.Fatalf("count jobs: %v", err)
+	}
+	if batches != 0 || jobs != 0 {
+		t.Errorf("failed batch left %d batches and %d jobs behind, want none", batches, jobs)
+	}
+}
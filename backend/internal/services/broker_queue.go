@@ -0,0 +1,429 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// jobBroker delivers job IDs between the API and the workers. The job row in
+// prediction_jobs stays the source of truth; a broker message only says which
+// job to claim next.
+type jobBroker interface {
+	Publish(ctx context.Context, request models.PredictionJobRequest, delay time.Duration) error
+	DeadLetter(ctx context.Context, request models.PredictionJobRequest, reason string) error
+	Consume(ctx context.Context, concurrency int, handle func(workerID int, request models.PredictionJobRequest) error) error
+	Close() error
+}
+
+type brokerDelivery struct {
+	request models.PredictionJobRequest
+	done    chan error
+}
+
+// BrokerQueue keeps jobs in prediction_jobs like DBQueue but dispatches them
+// through RabbitMQ or Kafka instead of polling. A broker message stays
+// unacknowledged until the worker that claimed its job calls Ack or Nack, so a
+// crashed backend has its messages redelivered to another consumer.
+//
+// Messages are never sent to the broker directly. Every job change writes its
+// message to job_outbox in the same transaction, and an OutboxRelay forwards
+// it, so a broker outage delays jobs instead of losing them.
+type BrokerQueue struct {
+	*DBQueue
+
+	queueType   string
+	broker      jobBroker
+	concurrency int
+	deliveries  chan *brokerDelivery
+	relay       *OutboxRelay
+
+	mu       sync.Mutex
+	inflight map[uuid.UUID]*brokerDelivery
+
+	startOnce sync.Once
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopped   chan struct{}
+	relayed   chan struct{}
+}
+
+func NewBrokerQueue(queueType string, broker jobBroker, store *DBQueue, concurrency int, outboxInterval time.Duration) *BrokerQueue {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := &BrokerQueue{
+		DBQueue:     store,
+		queueType:   queueType,
+		broker:      broker,
+		concurrency: concurrency,
+		deliveries:  make(chan *brokerDelivery),
+		relay:       NewOutboxRelay(store.conn, broker, outboxInterval),
+		inflight:    make(map[uuid.UUID]*brokerDelivery),
+		ctx:         ctx,
+		cancel:      cancel,
+		stopped:     make(chan struct{}),
+		relayed:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(q.relayed)
+		q.relay.Run(ctx)
+	}()
+
+	return q
+}
+
+func (q *BrokerQueue) Type() string {
+	return q.queueType
+}
+
+func (q *BrokerQueue) Publish(imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error) {
+	var job *models.PredictionJob
+	err := q.inTx(func(tx *DBQueue) error {
+		var err error
+		job, err = publishWithOutbox(tx, imageID, imagePath, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.relay.Wake()
+	return job, nil
+}
+
+// PublishTx writes the job and its outbox message in tx. The relay cannot see
+// the message before the caller commits, so it is sent on the relay's next
+// round rather than right away.
+func (q *BrokerQueue) PublishTx(tx *sqlx.Tx, imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error) {
+	bound := &DBQueue{
+		maxRetries:  q.maxRetries,
+		retryPolicy: q.retryPolicy,
+		conn:        q.conn,
+		db:          tx,
+	}
+	return publishWithOutbox(bound, imageID, imagePath, opts)
+}
+
+func publishWithOutbox(tx *DBQueue, imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error) {
+	job, err := tx.Publish(imageID, imagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	request := models.PredictionJobRequest{
+		JobID:     job.ID,
+		ImageID:   imageID,
+		ImagePath: imagePath,
+		Priority:  job.Priority,
+		CreatedAt: job.CreatedAt,
+	}
+	if err := addToOutbox(tx.db, outboxPublish, request, 0, ""); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Claim waits for the next broker delivery and leases its job to workerID. It
+// returns nil without an error when ctx is cancelled first.
+func (q *BrokerQueue) Claim(ctx context.Context, workerID string, lease time.Duration) (*models.PredictionJob, error) {
+	q.startOnce.Do(func() {
+		go q.consume()
+	})
+
+	for {
+		var delivery *brokerDelivery
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case delivery = <-q.deliveries:
+		}
+
+		job, err := q.ClaimJob(delivery.request.JobID, workerID, lease)
+		if err != nil {
+			delivery.done <- err
+			return nil, err
+		}
+
+		if job == nil {
+			// Redelivery of a job that is already finished or held by
+			// someone else; the message can simply be acknowledged. A job
+			// that is pending but not yet due was rescheduled or arrived
+			// early, so it is sent back to the broker with the remaining
+			// delay first.
+			err := q.inTx(func(tx *DBQueue) error {
+				return resendIfPending(tx, delivery.request.JobID)
+			})
+			q.relay.Wake()
+			delivery.done <- err
+			continue
+		}
+
+		q.mu.Lock()
+		q.inflight[job.ID] = delivery
+		q.mu.Unlock()
+
+		return job, nil
+	}
+}
+
+func (q *BrokerQueue) Ack(jobID uuid.UUID, workerID string, predictionID uuid.UUID) error {
+	err := q.DBQueue.Ack(jobID, workerID, predictionID)
+	q.settle(jobID, err)
+	return err
+}
+
+// Nack records the failed attempt and publishes the job to the broker's retry
+// or dead-letter destination before the original message is acknowledged.
+func (q *BrokerQueue) Nack(job *models.PredictionJob, reason string, retryable bool) (models.JobStatus, error) {
+	var status models.JobStatus
+	err := q.inTx(func(tx *DBQueue) error {
+		var delay time.Duration
+		var err error
+		status, delay, err = tx.nack(job, reason, retryable)
+		if err != nil {
+			return err
+		}
+
+		if status == models.JobStatusDeadLetter {
+			return deadLetter(tx, job.ID, job.ImageID, job.Priority, reason)
+		}
+		return redispatch(tx, job.ID, job.ImageID, job.Priority, delay)
+	})
+
+	q.relay.Wake()
+	q.settle(job.ID, err)
+	return status, err
+}
+
+func (q *BrokerQueue) AckCancel(jobID uuid.UUID, workerID string) error {
+	err := q.DBQueue.AckCancel(jobID, workerID)
+	q.settle(jobID, err)
+	return err
+}
+
+// Update reschedules the job in the database and leaves a fresh message
+// carrying the new priority in the outbox until the job is due. The old
+// message is acknowledged when it arrives because its job is then either not
+// yet due or already claimed.
+func (q *BrokerQueue) Update(jobID uuid.UUID, update models.JobUpdate) (*models.PredictionJob, error) {
+	var job *models.PredictionJob
+	err := q.inTx(func(tx *DBQueue) error {
+		var err error
+		job, err = tx.Update(jobID, update)
+		if err != nil {
+			return err
+		}
+		return resendIfPending(tx, job.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.relay.Wake()
+	return job, nil
+}
+
+func (q *BrokerQueue) ReapExpired() (int, int, error) {
+	var reaped []reapedJob
+	err := q.inTx(func(tx *DBQueue) error {
+		var err error
+		reaped, err = tx.reapExpiredJobs()
+		if err != nil {
+			return err
+		}
+
+		for _, job := range reaped {
+			switch job.Status {
+			case string(models.JobStatusPending):
+				err = redispatch(tx, job.ID, job.ImageID, job.Priority, 0)
+			case string(models.JobStatusDeadLetter):
+				err = deadLetter(tx, job.ID, job.ImageID, job.Priority, "lease expired")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	q.relay.Wake()
+	requeued, deadLettered := countReaped(reaped)
+	return requeued, deadLettered, nil
+}
+
+func (q *BrokerQueue) Requeue(jobID uuid.UUID) (*models.PredictionJob, error) {
+	var job *models.PredictionJob
+	err := q.inTx(func(tx *DBQueue) error {
+		var err error
+		job, err = tx.Requeue(jobID)
+		if err != nil {
+			return err
+		}
+		return redispatch(tx, job.ID, job.ImageID, job.Priority, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.relay.Wake()
+	return job, nil
+}
+
+func (q *BrokerQueue) Stats() (map[string]interface{}, error) {
+	stats, err := q.DBQueue.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	outboxPending, err := q.relay.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	inFlight := len(q.inflight)
+	q.mu.Unlock()
+
+	stats["backend"] = q.queueType
+	stats["in_flight"] = inFlight
+	stats["outbox_pending"] = outboxPending
+	return stats, nil
+}
+
+// Close stops consuming, leaving unfinished messages to be redelivered, stops
+// the outbox relay and closes the broker connection.
+func (q *BrokerQueue) Close() error {
+	q.cancel()
+	<-q.relayed
+
+	started := true
+	q.startOnce.Do(func() {
+		started = false
+	})
+	if started {
+		<-q.stopped
+	}
+
+	return q.broker.Close()
+}
+
+// consume keeps a broker consumer running until Close, reconnecting after
+// failures.
+func (q *BrokerQueue) consume() {
+	defer close(q.stopped)
+
+	for {
+		err := q.broker.Consume(q.ctx, q.concurrency, func(workerID int, request models.PredictionJobRequest) error {
+			return q.deliver(request)
+		})
+		if q.ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("%s consumer stopped: %v; reconnecting", q.queueType, err)
+		if !sleepContext(q.ctx, 5*time.Second) {
+			return
+		}
+	}
+}
+
+// deliver hands a message to Claim and blocks until its job is settled. The
+// returned error makes the broker redeliver the message.
+func (q *BrokerQueue) deliver(request models.PredictionJobRequest) error {
+	delivery := &brokerDelivery{
+		request: request,
+		done:    make(chan error, 1),
+	}
+
+	select {
+	case q.deliveries <- delivery:
+	case <-q.ctx.Done():
+		return fmt.Errorf("queue is shutting down")
+	}
+
+	select {
+	case err := <-delivery.done:
+		return err
+	case <-q.ctx.Done():
+		return fmt.Errorf("queue is shutting down")
+	}
+}
+
+// settle releases the message of a claimed job. A job whose lease was lost has
+// already been sent again by the reaper, so its old message is acknowledged
+// rather than redelivered.
+func (q *BrokerQueue) settle(jobID uuid.UUID, err error) {
+	if errors.Is(err, ErrJobLeaseLost) {
+		err = nil
+	}
+
+	q.mu.Lock()
+	delivery, ok := q.inflight[jobID]
+	delete(q.inflight, jobID)
+	q.mu.Unlock()
+
+	if ok {
+		delivery.done <- err
+	}
+}
+
+// resendIfPending writes a fresh message for a job that is still pending. The
+// message stays in the outbox until the job is due instead of travelling
+// through the broker's delayed retry path.
+func resendIfPending(tx *DBQueue, jobID uuid.UUID) error {
+	delay, pending, err := tx.pendingDelay(jobID)
+	if err != nil || !pending {
+		return err
+	}
+
+	job, err := tx.Get(jobID)
+	if err != nil {
+		return err
+	}
+
+	request := models.PredictionJobRequest{
+		JobID:     job.ID,
+		ImageID:   job.ImageID,
+		Priority:  job.Priority,
+		CreatedAt: time.Now(),
+	}
+	return holdInOutbox(tx.db, request, delay)
+}
+
+func redispatch(tx *DBQueue, jobID, imageID uuid.UUID, priority int, delay time.Duration) error {
+	request := models.PredictionJobRequest{
+		JobID:     jobID,
+		ImageID:   imageID,
+		Priority:  priority,
+		CreatedAt: time.Now(),
+	}
+
+	return addToOutbox(tx.db, outboxPublish, request, delay, "")
+}
+
+func deadLetter(tx *DBQueue, jobID, imageID uuid.UUID, priority int, reason string) error {
+	request := models.PredictionJobRequest{
+		JobID:     jobID,
+		ImageID:   imageID,
+		Priority:  priority,
+		CreatedAt: time.Now(),
+	}
+
+	return addToOutbox(tx.db, outboxDeadLetter, request, 0, reason)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("ML service circuit breaker is open")
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calls to a failing dependency. After threshold
+// consecutive failures it opens and rejects calls for openTimeout; then it
+// lets a single probe through (half-open) and closes again if the probe
+// succeeds or reopens if it fails.
+type CircuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	return &CircuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       CircuitClosed,
+	}
+}
+
+// Allow reports whether a call may proceed, returning ErrCircuitOpen when it
+// may not. Every allowed call must be followed by Success or Failure.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.openTimeout {
+		b.state = CircuitHalfOpen
+	}
+
+	switch b.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release ends an allowed call without recording an outcome, for calls the
+// caller abandoned before the dependency answered.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns the current state and, while open, how long until the next
+// probe is allowed.
+func (b *CircuitBreaker) State() (string, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitOpen {
+		return b.state, 0
+	}
+
+	remaining := b.openTimeout - time.Since(b.openedAt)
+	if remaining <= 0 {
+		return CircuitHalfOpen, 0
+	}
+	return CircuitOpen, remaining
+}
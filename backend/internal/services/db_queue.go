@@ -0,0 +1,718 @@
+package services
+
+import (
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const jobColumns = `
+	id, image_id, status, retry_count, max_retries,
+	scheduled_at, started_at, completed_at, COALESCE(error_message, '') AS error_message,
+	prediction_id, COALESCE(locked_by, '') AS locked_by, lease_expires_at,
+	priority, COALESCE(client_id, '') AS client_id, cancel_requested, batch_id, created_at`
+
+// DBQueue keeps jobs in the prediction_jobs table. Jobs are claimed with
+// FOR UPDATE SKIP LOCKED, so several backend replicas can share the table.
+// When a notify channel is set, every newly due job is announced with
+// pg_notify and idle workers wake on it instead of waiting for the next poll.
+// The broker-backed queues use DBQueue without a channel for job bookkeeping.
+type DBQueue struct {
+	maxRetries  int
+	retryPolicy RetryPolicy
+	channel     string
+	dsn         string
+	conn        *database.DB
+	db          queryer
+
+	notifierOnce sync.Once
+	notifier     *JobNotifier
+}
+
+func NewDBQueue(maxRetries int, retryPolicy RetryPolicy, channel, dsn string, db *database.DB) *DBQueue {
+	return &DBQueue{
+		maxRetries:  maxRetries,
+		retryPolicy: retryPolicy,
+		channel:     channel,
+		dsn:         dsn,
+		conn:        db,
+		db:          db,
+	}
+}
+
+// queryer is satisfied by both *database.DB and *sqlx.Tx, so the same queue
+// methods run inside or outside a transaction.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+}
+
+// inTx runs fn with a copy of the queue bound to a single transaction. The
+// copy never notifies listeners; callers do that after the commit.
+func (q *DBQueue) inTx(fn func(tx *DBQueue) error) error {
+	return q.conn.WithTx(func(tx *sqlx.Tx) error {
+		return fn(&DBQueue{
+			maxRetries:  q.maxRetries,
+			retryPolicy: q.retryPolicy,
+			conn:        q.conn,
+			db:          tx,
+		})
+	})
+}
+
+func (q *DBQueue) Type() string {
+	return "db"
+}
+
+func (q *DBQueue) Close() error {
+	// Marks the listener as never needed if it has not been started yet.
+	q.notifierOnce.Do(func() {})
+
+	if q.notifier != nil {
+		return q.notifier.Close()
+	}
+	return nil
+}
+
+// WaitForJob blocks until a job is announced on the notify channel or timeout
+// passes. The timeout doubles as the fallback poll that picks up scheduled
+// retries, which are never announced. The LISTEN connection is opened on the
+// first call, so replicas that only serve the API never hold one.
+func (q *DBQueue) WaitForJob(ctx context.Context, timeout time.Duration) {
+	q.notifierOnce.Do(func() {
+		if q.channel == "" {
+			return
+		}
+
+		notifier, err := NewJobNotifier(q.dsn, q.channel)
+		if err != nil {
+			log.Printf("Job notifications disabled, falling back to polling: %v", err)
+			return
+		}
+		q.notifier = notifier
+	})
+
+	if q.notifier == nil {
+		sleepContext(ctx, timeout)
+		return
+	}
+
+	q.notifier.Wait(ctx, timeout)
+}
+
+// notify announces a job that is due now. Failures are only logged because
+// the fallback poll still picks the job up.
+func (q *DBQueue) notify(jobID uuid.UUID) {
+	if q.channel == "" {
+		return
+	}
+
+	if _, err := q.db.Exec(`SELECT pg_notify($1, $2)`, q.channel, jobID.String()); err != nil {
+		log.Printf("Failed to notify %s about job %s: %v", q.channel, jobID, err)
+	}
+}
+
+func (q *DBQueue) Publish(imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error) {
+	job := &models.PredictionJob{
+		ID:          uuid.New(),
+		ImageID:     imageID,
+		Status:      string(models.JobStatusPending),
+		RetryCount:  0,
+		MaxRetries:  q.maxRetries,
+		Priority:    opts.Priority,
+		ClientID:    opts.ClientID,
+		BatchID:     opts.BatchID,
+		ScheduledAt: time.Now(),
+		CreatedAt:   time.Now(),
+	}
+
+	query := `
+		INSERT INTO prediction_jobs (id, image_id, status, retry_count, max_retries, priority, client_id, batch_id, scheduled_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)
+	`
+
+	_, err := q.db.Exec(query,
+		job.ID,
+		job.ImageID,
+		job.Status,
+		job.RetryCount,
+		job.MaxRetries,
+		job.Priority,
+		job.ClientID,
+		job.BatchID,
+		job.ScheduledAt,
+		job.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prediction job: %w", err)
+	}
+
+	q.notify(job.ID)
+
+	return job, nil
+}
+
+// PublishTx creates the job in tx. The job is announced right away because
+// Postgres only delivers a notification once its transaction commits.
+func (q *DBQueue) PublishTx(tx *sqlx.Tx, imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error) {
+	bound := &DBQueue{
+		maxRetries:  q.maxRetries,
+		retryPolicy: q.retryPolicy,
+		channel:     q.channel,
+		conn:        q.conn,
+		db:          tx,
+	}
+	return bound.Publish(imageID, imagePath, opts)
+}
+
+func (q *DBQueue) Get(id uuid.UUID) (*models.PredictionJob, error) {
+	var job models.PredictionJob
+	query := `
+		SELECT ` + jobColumns + `
+		FROM prediction_jobs
+		WHERE id = $1
+	`
+
+	err := q.db.Get(&job, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return &job, nil
+}
+
+func (q *DBQueue) GetPendingJobs(limit int) ([]models.PredictionJob, error) {
+	var jobs []models.PredictionJob
+	query := `
+		SELECT ` + jobColumns + `
+		FROM prediction_jobs
+		WHERE status = 'pending' AND scheduled_at <= NOW()
+		ORDER BY priority DESC, scheduled_at ASC
+		LIMIT $1
+	`
+
+	err := q.db.Select(&jobs, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (q *DBQueue) Claim(ctx context.Context, workerID string, lease time.Duration) (*models.PredictionJob, error) {
+	jobs, err := q.ClaimPendingJobs(workerID, 1, lease)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+
+	return &jobs[0], nil
+}
+
+// ClaimPendingJobs moves up to limit due jobs to processing and leases them
+// to workerID until NOW() + lease. The lease has to be renewed with
+// RenewLease while the job is in flight, otherwise ReapExpired hands the job
+// to another worker.
+//
+// Jobs are taken by priority first. Within a priority, clients take turns:
+// every due job gets a turn number counting its client's jobs already
+// processing and the client's older due jobs, and the lowest turn goes next.
+// One client's bulk upload is thus round-robined with everyone else's work
+// instead of running ahead of it; ties go to the oldest job.
+func (q *DBQueue) ClaimPendingJobs(workerID string, limit int, lease time.Duration) ([]models.PredictionJob, error) {
+	var jobs []models.PredictionJob
+	// Window functions cannot be combined with FOR UPDATE, so turns are
+	// numbered in a CTE and joined back to the locked rows.
+	query := `
+		WITH running AS (
+			SELECT COALESCE(client_id, '') AS client_id, COUNT(*) AS jobs
+			FROM prediction_jobs
+			WHERE status = 'processing'
+			GROUP BY COALESCE(client_id, '')
+		),
+		due AS (
+			SELECT id, COALESCE(client_id, '') AS client_id,
+			       row_number() OVER (
+			           PARTITION BY priority, COALESCE(client_id, '')
+			           ORDER BY scheduled_at, created_at
+			       ) AS turn
+			FROM prediction_jobs
+			WHERE status = 'pending' AND scheduled_at <= NOW()
+		)
+		UPDATE prediction_jobs
+		SET status = 'processing', started_at = NOW(),
+		    locked_by = $2, lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT j.id
+			FROM prediction_jobs j
+			JOIN due d ON d.id = j.id
+			LEFT JOIN running r ON r.client_id = d.client_id
+			WHERE j.status = 'pending' AND j.scheduled_at <= NOW()
+			ORDER BY j.priority DESC, d.turn + COALESCE(r.jobs, 0) ASC, j.scheduled_at ASC
+			LIMIT $1
+			FOR UPDATE OF j SKIP LOCKED
+		)
+		RETURNING ` + jobColumns + `
+	`
+
+	err := q.db.Select(&jobs, query, limit, workerID, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ClaimJob leases a single due pending job delivered by a broker. It returns
+// nil without an error when the job is not claimable, e.g. because the
+// message was redelivered after the job had already been processed or the job
+// has been rescheduled.
+func (q *DBQueue) ClaimJob(jobID uuid.UUID, workerID string, lease time.Duration) (*models.PredictionJob, error) {
+	var job models.PredictionJob
+	query := `
+		UPDATE prediction_jobs
+		SET status = 'processing', started_at = NOW(),
+		    locked_by = $2, lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1 AND status = 'pending' AND scheduled_at <= NOW()
+		RETURNING ` + jobColumns + `
+	`
+
+	err := q.db.Get(&job, query, jobID, workerID, lease.Milliseconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return &job, nil
+}
+
+func (q *DBQueue) RenewLease(jobID uuid.UUID, workerID string, lease time.Duration) error {
+	var cancelRequested bool
+	query := `
+		UPDATE prediction_jobs
+		SET lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1 AND locked_by = $2 AND status = 'processing'
+		RETURNING cancel_requested
+	`
+
+	err := q.db.Get(&cancelRequested, query, jobID, workerID, lease.Milliseconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJobLeaseLost
+	}
+	if err != nil {
+		return fmt.Errorf("failed to renew job lease: %w", err)
+	}
+
+	if cancelRequested {
+		return ErrJobCancelled
+	}
+
+	return nil
+}
+
+// pendingDelay reports how long a pending job has until it is due, measured
+// by the database clock. ok is false when the job is not pending.
+func (q *DBQueue) pendingDelay(jobID uuid.UUID) (delay time.Duration, ok bool, err error) {
+	var ms float64
+	query := `
+		SELECT GREATEST(EXTRACT(EPOCH FROM (scheduled_at - NOW())) * 1000, 0)
+		FROM prediction_jobs
+		WHERE id = $1 AND status = 'pending'
+	`
+
+	err = q.db.Get(&ms, query, jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get job schedule: %w", err)
+	}
+
+	return time.Duration(ms) * time.Millisecond, true, nil
+}
+
+type reapedJob struct {
+	ID       uuid.UUID `db:"id"`
+	ImageID  uuid.UUID `db:"image_id"`
+	Status   string    `db:"status"`
+	Priority int       `db:"priority"`
+}
+
+func (q *DBQueue) ReapExpired() (int, int, error) {
+	reaped, err := q.reapExpiredJobs()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, job := range reaped {
+		if job.Status == string(models.JobStatusPending) {
+			q.notify(job.ID)
+		}
+	}
+
+	requeued, deadLettered := countReaped(reaped)
+	return requeued, deadLettered, nil
+}
+
+// reapExpiredJobs returns processing jobs whose lease has expired to pending,
+// counting the lost attempt toward retry_count. Jobs that have no retries
+// left are moved to dead_letter, and jobs with a pending cancellation
+// request to cancelled.
+func (q *DBQueue) reapExpiredJobs() ([]reapedJob, error) {
+	var reaped []reapedJob
+	query := `
+		UPDATE prediction_jobs
+		SET status = CASE
+		        WHEN cancel_requested THEN 'cancelled'
+		        WHEN retry_count < max_retries THEN 'pending'
+		        ELSE 'dead_letter'
+		    END,
+		    retry_count = CASE WHEN NOT cancel_requested AND retry_count < max_retries THEN retry_count + 1 ELSE retry_count END,
+		    completed_at = CASE WHEN NOT cancel_requested AND retry_count < max_retries THEN NULL ELSE NOW() END,
+		    error_message = 'lease expired while held by ' || COALESCE(locked_by, 'unknown worker'),
+		    scheduled_at = NOW(), started_at = NULL, locked_by = NULL, lease_expires_at = NULL
+		WHERE status = 'processing' AND lease_expires_at < NOW()
+		RETURNING id, image_id, status, priority
+	`
+
+	err := q.db.Select(&reaped, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reap expired jobs: %w", err)
+	}
+
+	return reaped, nil
+}
+
+func countReaped(reaped []reapedJob) (int, int) {
+	requeued, deadLettered := 0, 0
+	for _, job := range reaped {
+		switch job.Status {
+		case string(models.JobStatusPending):
+			requeued++
+		case string(models.JobStatusDeadLetter):
+			deadLettered++
+		}
+	}
+	return requeued, deadLettered
+}
+
+func (q *DBQueue) UpdateJobStatus(jobID uuid.UUID, status models.JobStatus, errorMessage string) error {
+	now := time.Now()
+	var query string
+	var args []interface{}
+
+	switch status {
+	case models.JobStatusProcessing:
+		query = `UPDATE prediction_jobs SET status = $1, started_at = $2 WHERE id = $3`
+		args = []interface{}{status, now, jobID}
+	case models.JobStatusCompleted:
+		query = `UPDATE prediction_jobs SET status = $1, completed_at = $2, locked_by = NULL, lease_expires_at = NULL WHERE id = $3`
+		args = []interface{}{status, now, jobID}
+	case models.JobStatusFailed:
+		query = `UPDATE prediction_jobs SET status = $1, error_message = $2, completed_at = $3, locked_by = NULL, lease_expires_at = NULL WHERE id = $4`
+		args = []interface{}{status, errorMessage, now, jobID}
+	default:
+		query = `UPDATE prediction_jobs SET status = $1 WHERE id = $2`
+		args = []interface{}{status, jobID}
+	}
+
+	_, err := q.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+
+	return nil
+}
+
+func (q *DBQueue) SetPrediction(jobID, predictionID uuid.UUID) error {
+	query := `UPDATE prediction_jobs SET prediction_id = $1 WHERE id = $2`
+
+	_, err := q.db.Exec(query, predictionID, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to link job to prediction: %w", err)
+	}
+
+	return nil
+}
+
+func (q *DBQueue) Ack(jobID uuid.UUID, workerID string, predictionID uuid.UUID) error {
+	query := `
+		UPDATE prediction_jobs
+		SET status = 'completed', prediction_id = $3, completed_at = NOW(),
+		    locked_by = NULL, lease_expires_at = NULL
+		WHERE id = $1 AND locked_by = $2 AND status = 'processing'
+	`
+
+	result, err := q.db.Exec(query, jobID, workerID, predictionID)
+	if err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+
+	return leaseHeld(result)
+}
+
+func (q *DBQueue) Nack(job *models.PredictionJob, reason string, retryable bool) (models.JobStatus, error) {
+	status, _, err := q.nack(job, reason, retryable)
+	return status, err
+}
+
+// nack is Nack that also returns the retry delay the job was rescheduled
+// with, so BrokerQueue can redispatch it after the same delay.
+func (q *DBQueue) nack(job *models.PredictionJob, reason string, retryable bool) (models.JobStatus, time.Duration, error) {
+	if !retryable || job.RetryCount >= job.MaxRetries {
+		return models.JobStatusDeadLetter, 0, q.DeadLetterJob(job.ID, job.LockedBy, reason)
+	}
+
+	delay := q.retryPolicy.Delay(job.RetryCount)
+	return models.JobStatusPending, delay, q.RetryJob(job.ID, job.LockedBy, reason, delay)
+}
+
+func (q *DBQueue) AckCancel(jobID uuid.UUID, workerID string) error {
+	query := `
+		UPDATE prediction_jobs
+		SET status = 'cancelled', completed_at = NOW(),
+		    locked_by = NULL, lease_expires_at = NULL
+		WHERE id = $1 AND locked_by = $2 AND status = 'processing'
+	`
+
+	result, err := q.db.Exec(query, jobID, workerID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	return leaseHeld(result)
+}
+
+// leaseHeld turns an update guarded by the worker's lease into
+// ErrJobLeaseLost when it matched no row.
+func leaseHeld(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check job lease: %w", err)
+	}
+	if rows == 0 {
+		return ErrJobLeaseLost
+	}
+
+	return nil
+}
+
+func (q *DBQueue) Cancel(jobID uuid.UUID) (*models.PredictionJob, error) {
+	var job models.PredictionJob
+	query := `
+		UPDATE prediction_jobs
+		SET cancel_requested = TRUE,
+		    status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE status END,
+		    completed_at = CASE WHEN status = 'pending' THEN NOW() ELSE completed_at END
+		WHERE id = $1 AND status IN ('pending', 'processing')
+		RETURNING ` + jobColumns + `
+	`
+
+	err := q.db.Get(&job, query, jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := q.Get(jobID); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobFinished
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	return &job, nil
+}
+
+func (q *DBQueue) Update(jobID uuid.UUID, update models.JobUpdate) (*models.PredictionJob, error) {
+	var delay *int64
+	if update.ScheduledAt != nil {
+		ms := time.Until(*update.ScheduledAt).Milliseconds()
+		delay = &ms
+	}
+
+	var job models.PredictionJob
+	query := `
+		UPDATE prediction_jobs
+		SET priority = COALESCE($2, priority),
+		    scheduled_at = CASE
+		        WHEN $3::BIGINT IS NULL THEN scheduled_at
+		        ELSE NOW() + $3 * INTERVAL '1 millisecond'
+		    END
+		WHERE id = $1 AND status = 'pending'
+		RETURNING ` + jobColumns + `
+	`
+
+	err := q.db.Get(&job, query, jobID, update.Priority, delay)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := q.Get(jobID); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotPending
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+
+	q.notify(job.ID)
+
+	return &job, nil
+}
+
+// RetryJob puts a job held by workerID back to pending after delay and counts
+// the attempt toward retry_count.
+func (q *DBQueue) RetryJob(jobID uuid.UUID, workerID string, errorMessage string, delay time.Duration) error {
+	query := `
+		UPDATE prediction_jobs
+		SET status = 'pending', retry_count = retry_count + 1, error_message = $3,
+		    scheduled_at = NOW() + $4 * INTERVAL '1 millisecond',
+		    started_at = NULL, locked_by = NULL, lease_expires_at = NULL
+		WHERE id = $1 AND locked_by = $2 AND status = 'processing'
+	`
+
+	result, err := q.db.Exec(query, jobID, workerID, errorMessage, delay.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	return leaseHeld(result)
+}
+
+// DeadLetterJob parks a job held by workerID that failed permanently so it can
+// be inspected and requeued by an operator.
+func (q *DBQueue) DeadLetterJob(jobID uuid.UUID, workerID string, errorMessage string) error {
+	query := `
+		UPDATE prediction_jobs
+		SET status = 'dead_letter', error_message = $3, completed_at = NOW(),
+		    locked_by = NULL, lease_expires_at = NULL
+		WHERE id = $1 AND locked_by = $2 AND status = 'processing'
+	`
+
+	result, err := q.db.Exec(query, jobID, workerID, errorMessage)
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter job: %w", err)
+	}
+
+	return leaseHeld(result)
+}
+
+func (q *DBQueue) ListByBatch(batchID uuid.UUID) ([]models.PredictionJob, error) {
+	var jobs []models.PredictionJob
+	query := `
+		SELECT ` + jobColumns + `
+		FROM prediction_jobs
+		WHERE batch_id = $1
+		ORDER BY created_at ASC
+	`
+
+	err := q.db.Select(&jobs, query, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (q *DBQueue) ListDeadLetter(limit, offset int) ([]models.PredictionJob, int, error) {
+	var jobs []models.PredictionJob
+	query := `
+		SELECT ` + jobColumns + `
+		FROM prediction_jobs
+		WHERE status = 'dead_letter'
+		ORDER BY completed_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	err := q.db.Select(&jobs, query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get dead-letter jobs: %w", err)
+	}
+
+	var total int
+	err = q.db.Get(&total, `SELECT COUNT(*) FROM prediction_jobs WHERE status = 'dead_letter'`)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count dead-letter jobs: %w", err)
+	}
+
+	return jobs, total, nil
+}
+
+// Requeue gives a dead-lettered job a fresh set of retries and schedules it
+// immediately.
+func (q *DBQueue) Requeue(jobID uuid.UUID) (*models.PredictionJob, error) {
+	var job models.PredictionJob
+	query := `
+		UPDATE prediction_jobs
+		SET status = 'pending', retry_count = 0, scheduled_at = NOW(),
+		    started_at = NULL, completed_at = NULL, prediction_id = NULL,
+		    error_message = NULL, cancel_requested = FALSE
+		WHERE id = $1 AND status = 'dead_letter'
+		RETURNING ` + jobColumns + `
+	`
+
+	err := q.db.Get(&job, query, jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to requeue job: %w", err)
+	}
+
+	q.notify(job.ID)
+
+	return &job, nil
+}
+
+func (q *DBQueue) Stats() (map[string]interface{}, error) {
+	query := `
+		SELECT
+			COUNT(*) as total,
+			COUNT(CASE WHEN status = 'pending' THEN 1 END) as pending,
+			COUNT(CASE WHEN status = 'processing' THEN 1 END) as processing,
+			COUNT(CASE WHEN status = 'completed' THEN 1 END) as completed,
+			COUNT(CASE WHEN status = 'failed' THEN 1 END) as failed,
+			COUNT(CASE WHEN status = 'dead_letter' THEN 1 END) as dead_letter,
+			COUNT(CASE WHEN status = 'cancelled' THEN 1 END) as cancelled
+		FROM prediction_jobs
+		WHERE created_at > NOW() - INTERVAL '24 hours'
+	`
+
+	var stats struct {
+		Total      int `db:"total"`
+		Pending    int `db:"pending"`
+		Processing int `db:"processing"`
+		Completed  int `db:"completed"`
+		Failed     int `db:"failed"`
+		DeadLetter int `db:"dead_letter"`
+		Cancelled  int `db:"cancelled"`
+	}
+
+	err := q.db.Get(&stats, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job stats: %w", err)
+	}
+
+	return map[string]interface{}{
+		"backend":     q.Type(),
+		"total":       stats.Total,
+		"pending":     stats.Pending,
+		"processing":  stats.Processing,
+		"completed":   stats.Completed,
+		"failed":      stats.Failed,
+		"dead_letter": stats.DeadLetter,
+		"cancelled":   stats.Cancelled,
+	}, nil
+}
@@ -3,6 +3,11 @@ package services
 import (
 	"car-status-backend/internal/database"
 	"car-status-backend/internal/models"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -12,8 +17,12 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+var ErrImageNotFound = errors.New("image not found")
+
 type ImageService struct {
 	db         *database.DB
 	uploadPath string
@@ -32,7 +41,11 @@ func NewImageService(db *database.DB, uploadPath string, maxSize int64, allowedT
 	}
 }
 
-func (s *ImageService) UploadImage(file multipart.File, header *multipart.FileHeader) (*models.CarImage, error) {
+// UploadImage stores the file and its car_images row. When inTx is not nil it
+// runs in the transaction that inserts the row, so work that depends on the
+// image, such as queueing its prediction job, is committed together with it;
+// if inTx fails nothing is stored and its error is returned unchanged.
+func (s *ImageService) UploadImage(ctx context.Context, file multipart.File, header *multipart.FileHeader, inTx func(tx *sqlx.Tx, image *models.CarImage) error) (*models.CarImage, error) {
 	if header.Size > s.maxSize {
 		return nil, fmt.Errorf("file size %d exceeds maximum allowed size %d", header.Size, s.maxSize)
 	}
@@ -59,7 +72,10 @@ func (s *ImageService) UploadImage(file multipart.File, header *multipart.FileHe
 	}
 	defer dst.Close()
 
-	_, err = io.Copy(dst, file)
+	// The SHA-256 of the content identifies re-uploads of the same photo, so
+	// their predictions can be reused.
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, hash), file)
 	if err != nil {
 		os.Remove(filePath)
 		return nil, fmt.Errorf("failed to save file: %w", err)
@@ -72,43 +88,58 @@ func (s *ImageService) UploadImage(file multipart.File, header *multipart.FileHe
 		FilePath:     absolutePath,
 		FileSize:     header.Size,
 		MimeType:     mimeType,
+		ContentHash:  hex.EncodeToString(hash.Sum(nil)),
 		UploadedAt:   time.Now(),
 		CreatedAt:    time.Now(),
 	}
 
 	query := `
-		INSERT INTO car_images (id, filename, original_name, file_path, file_size, mime_type, uploaded_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO car_images (id, filename, original_name, file_path, file_size, mime_type, content_hash, uploaded_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
-	_, err = s.db.Exec(query,
-		carImage.ID,
-		carImage.Filename,
-		carImage.OriginalName,
-		carImage.FilePath,
-		carImage.FileSize,
-		carImage.MimeType,
-		carImage.UploadedAt,
-		carImage.CreatedAt,
-	)
+	err = s.db.WithTx(func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query,
+			carImage.ID,
+			carImage.Filename,
+			carImage.OriginalName,
+			carImage.FilePath,
+			carImage.FileSize,
+			carImage.MimeType,
+			carImage.ContentHash,
+			carImage.UploadedAt,
+			carImage.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save image metadata: %w", err)
+		}
+
+		if inTx != nil {
+			return inTx(tx, carImage)
+		}
+		return nil
+	})
 
 	if err != nil {
 		os.Remove(filePath)
-		return nil, fmt.Errorf("failed to save image metadata: %w", err)
+		return nil, err
 	}
 
 	return carImage, nil
 }
 
-func (s *ImageService) GetImageByID(id uuid.UUID) (*models.CarImage, error) {
+func (s *ImageService) GetImageByID(ctx context.Context, id uuid.UUID) (*models.CarImage, error) {
 	var image models.CarImage
 	query := `
-		SELECT id, filename, original_name, file_path, file_size, mime_type, uploaded_at, created_at
+		SELECT id, filename, original_name, file_path, file_size, mime_type, content_hash, uploaded_at, created_at
 		FROM car_images
 		WHERE id = $1
 	`
 
-	err := s.db.Get(&image, query, id)
+	err := s.db.GetContext(ctx, &image, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrImageNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get image: %w", err)
 	}
@@ -116,14 +147,80 @@ func (s *ImageService) GetImageByID(id uuid.UUID) (*models.CarImage, error) {
 	return &image, nil
 }
 
-func (s *ImageService) DeleteImage(id uuid.UUID) error {
-	image, err := s.GetImageByID(id)
+// GetImagesByIDs returns the images that exist among ids, in no particular
+// order.
+func (s *ImageService) GetImagesByIDs(ctx context.Context, ids []uuid.UUID) ([]models.CarImage, error) {
+	idStrings := make([]string, len(ids))
+	for i, id := range ids {
+		idStrings[i] = id.String()
+	}
+
+	var images []models.CarImage
+	query := `
+		SELECT id, filename, original_name, file_path, file_size, mime_type, content_hash, uploaded_at, created_at
+		FROM car_images
+		WHERE id = ANY($1::uuid[])
+	`
+
+	err := s.db.SelectContext(ctx, &images, query, pq.Array(idStrings))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get images: %w", err)
+	}
+
+	return images, nil
+}
+
+// FindImages returns up to limit images matching filter, oldest first.
+func (s *ImageService) FindImages(ctx context.Context, filter models.BatchFilter, limit int) ([]models.CarImage, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UploadedToday {
+		conditions = append(conditions, "i.uploaded_at >= date_trunc('day', NOW())")
+	}
+	if filter.UploadedAfter != nil {
+		args = append(args, *filter.UploadedAfter)
+		conditions = append(conditions, fmt.Sprintf("i.uploaded_at >= $%d", len(args)))
+	}
+	if filter.UploadedBefore != nil {
+		args = append(args, *filter.UploadedBefore)
+		conditions = append(conditions, fmt.Sprintf("i.uploaded_at < $%d", len(args)))
+	}
+	if filter.WithoutPrediction {
+		conditions = append(conditions, "NOT EXISTS (SELECT 1 FROM predictions p WHERE p.image_id = i.id)")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, limit)
+	query := fmt.Sprintf(`
+		SELECT i.id, i.filename, i.original_name, i.file_path, i.file_size, i.mime_type, i.content_hash, i.uploaded_at, i.created_at
+		FROM car_images i
+		%s
+		ORDER BY i.uploaded_at ASC
+		LIMIT $%d
+	`, where, len(args))
+
+	var images []models.CarImage
+	err := s.db.SelectContext(ctx, &images, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find images: %w", err)
+	}
+
+	return images, nil
+}
+
+func (s *ImageService) DeleteImage(ctx context.Context, id uuid.UUID) error {
+	image, err := s.GetImageByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	query := `DELETE FROM car_images WHERE id = $1`
-	_, err = s.db.Exec(query, id)
+	_, err = s.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete image from database: %w", err)
 	}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JobNotifier LISTENs on the queue's Postgres channel and wakes idle workers
+// whenever a job is published. Notifications are only a hint: a worker that
+// is woken still claims through the table, and one that misses a notification
+// (e.g. while the listener reconnects) finds the job on its next fallback poll.
+type JobNotifier struct {
+	channel  string
+	listener *pq.Listener
+
+	mu   sync.Mutex
+	wake chan struct{}
+	done chan struct{}
+}
+
+func NewJobNotifier(dsn, channel string) (*JobNotifier, error) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Job notifier on %s: %v", channel, err)
+		}
+	})
+
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	n := &JobNotifier{
+		channel:  channel,
+		listener: listener,
+		wake:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go n.run()
+
+	return n, nil
+}
+
+func (n *JobNotifier) run() {
+	for {
+		select {
+		case <-n.done:
+			return
+		case _, ok := <-n.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification is sent after a reconnect, when
+			// notifications may have been missed, so it wakes workers too.
+			n.broadcast()
+		case <-time.After(90 * time.Second):
+			go n.listener.Ping()
+		}
+	}
+}
+
+func (n *JobNotifier) broadcast() {
+	n.mu.Lock()
+	close(n.wake)
+	n.wake = make(chan struct{})
+	n.mu.Unlock()
+}
+
+// Wait blocks until the next notification, timeout or ctx cancellation,
+// whichever comes first.
+func (n *JobNotifier) Wait(ctx context.Context, timeout time.Duration) {
+	n.mu.Lock()
+	wake := n.wake
+	n.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	case <-wake:
+	}
+}
+
+func (n *JobNotifier) Close() error {
+	close(n.done)
+	return n.listener.Close()
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJobNotifierWakesAllWaiters(t *testing.T) {
+	n := &JobNotifier{wake: make(chan struct{})}
+
+	woken := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			n.Wait(context.Background(), time.Minute)
+			woken <- struct{}{}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	n.broadcast()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-woken:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of 2 waiters were woken", i)
+		}
+	}
+
+	// A broadcast only wakes current waiters; the next Wait runs to its
+	// timeout.
+	started := time.Now()
+	n.Wait(context.Background(), 20*time.Millisecond)
+	if waited := time.Since(started); waited < 20*time.Millisecond {
+		t.Errorf("Wait after the broadcast returned after %v, want the full timeout", waited)
+	}
+}
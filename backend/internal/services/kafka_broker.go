@@ -0,0 +1,330 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	kafkaRetryAtHeader = "retry-at"
+
+	// kafkaMaxHandleAttempts is how often a message is handed to the
+	// handler before it is moved to the dead-letter topic.
+	kafkaMaxHandleAttempts = 5
+)
+
+// KafkaBroker publishes prediction job messages to Kafka and consumes them in
+// a consumer group. Messages are keyed by image ID so every job for the same
+// image lands on the same partition and is processed in order.
+//
+// Besides the work topic and "<name>.dlq" for jobs that gave up, one retry
+// topic "<name>.retry.<ms>" is used per delay bucket. Every message in a retry
+// topic waits the same delay (its retry-at header), so the reader of a topic
+// only ever waits for the message that is due first. Offsets are committed
+// only after the handler succeeds, so a crash in the middle of a prediction
+// makes the message redeliver rather than disappear; a message the handler
+// keeps failing is moved to the dead-letter topic instead of blocking its
+// partition. Topics are created up front with the configured number of
+// partitions, so the work topic's readers consume in parallel.
+// Kafka has no notion of message priority, so jobs are consumed in partition
+// order whatever their priority.
+type KafkaBroker struct {
+	brokers    []string
+	topic      string
+	partitions int
+	writer     *kafka.Writer
+}
+
+func NewKafkaBroker(brokersURL, topic string, partitions int) (*KafkaBroker, error) {
+	var brokers []string
+	for _, broker := range strings.Split(brokersURL, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("QUEUE_URL must list at least one Kafka broker")
+	}
+	if partitions <= 0 {
+		partitions = 1
+	}
+
+	b := &KafkaBroker{
+		brokers:    brokers,
+		topic:      topic,
+		partitions: partitions,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+
+	if err := b.createTopics(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *KafkaBroker) topics() []string {
+	topics := []string{b.topic, b.deadLetterTopic()}
+	for _, bucket := range retryBuckets {
+		topics = append(topics, b.retryTopic(bucket))
+	}
+	return topics
+}
+
+// createTopics creates the topics that do not exist yet with b.partitions
+// partitions through the cluster controller. Existing topics are left alone;
+// one with fewer partitions than configured is only reported, since Kafka
+// would move keys to other partitions if they were added.
+func (b *KafkaBroker) createTopics() error {
+	conn, err := kafka.Dial("tcp", b.brokers[0])
+	if err != nil {
+		return fmt.Errorf("failed to connect to Kafka: %w", err)
+	}
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	if err != nil {
+		return fmt.Errorf("failed to find the Kafka controller: %w", err)
+	}
+
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return fmt.Errorf("failed to connect to the Kafka controller: %w", err)
+	}
+	defer controllerConn.Close()
+
+	var configs []kafka.TopicConfig
+	for _, topic := range b.topics() {
+		configs = append(configs, kafka.TopicConfig{
+			Topic:         topic,
+			NumPartitions: b.partitions,
+			// -1 takes the broker's default.replication.factor.
+			ReplicationFactor: -1,
+		})
+	}
+	if err := controllerConn.CreateTopics(configs...); err != nil {
+		return fmt.Errorf("failed to create Kafka topics: %w", err)
+	}
+
+	partitions, err := conn.ReadPartitions(b.topic)
+	if err != nil {
+		return fmt.Errorf("failed to read partitions of %s: %w", b.topic, err)
+	}
+	if len(partitions) < b.partitions {
+		log.Printf("Kafka topic %s has %d partitions, fewer than the %d configured; only %d readers will consume in parallel", b.topic, len(partitions), b.partitions, len(partitions))
+	}
+
+	return nil
+}
+
+func (b *KafkaBroker) retryTopic(bucket time.Duration) string {
+	return fmt.Sprintf("%s.retry.%d", b.topic, bucket.Milliseconds())
+}
+
+func (b *KafkaBroker) deadLetterTopic() string {
+	return b.topic + ".dlq"
+}
+
+// Publish writes the job to the work topic, or to the retry topic of the
+// longest bucket within delay, with a retry-at header, when delay is
+// positive. Rounding down delivers the job up to one bucket early;
+// BrokerQueue then keeps it in the outbox until it is due.
+func (b *KafkaBroker) Publish(ctx context.Context, request models.PredictionJobRequest, delay time.Duration) error {
+	bucket := retryBucket(delay)
+	if bucket <= 0 {
+		return b.write(ctx, b.topic, request, nil)
+	}
+
+	retryAt := time.Now().Add(bucket).UnixMilli()
+	return b.write(ctx, b.retryTopic(bucket), request, []kafka.Header{
+		{Key: kafkaRetryAtHeader, Value: []byte(strconv.FormatInt(retryAt, 10))},
+	})
+}
+
+func (b *KafkaBroker) DeadLetter(ctx context.Context, request models.PredictionJobRequest, reason string) error {
+	return b.write(ctx, b.deadLetterTopic(), request, []kafka.Header{
+		{Key: "error", Value: []byte(reason)},
+	})
+}
+
+func (b *KafkaBroker) write(ctx context.Context, topic string, request models.PredictionJobRequest, headers []kafka.Header) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	err = b.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   topic,
+		Key:     []byte(request.ImageID.String()),
+		Value:   body,
+		Headers: headers,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write message to %s: %w", topic, err)
+	}
+
+	return nil
+}
+
+// Consume runs concurrency group members on the work topic plus one on each
+// retry topic. It blocks until ctx is cancelled or a reader fails.
+func (b *KafkaBroker) Consume(ctx context.Context, concurrency int, handle func(workerID int, request models.PredictionJobRequest) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	topics := make([]string, 0, concurrency+len(retryBuckets))
+	for i := 0; i < concurrency; i++ {
+		topics = append(topics, b.topic)
+	}
+	for _, bucket := range retryBuckets {
+		topics = append(topics, b.retryTopic(bucket))
+	}
+
+	errs := make(chan error, len(topics))
+	var wg sync.WaitGroup
+
+	for i, topic := range topics {
+		wg.Add(1)
+		go func(workerID int, topic string) {
+			defer wg.Done()
+			if err := b.consumeTopic(ctx, topic, workerID, handle); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(i+1, topic)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+func (b *KafkaBroker) consumeTopic(ctx context.Context, topic string, workerID int, handle func(workerID int, request models.PredictionJobRequest) error) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  b.brokers,
+		GroupID:  b.topic + "-workers",
+		Topic:    topic,
+		MinBytes: 1,
+		MaxBytes: 10e6,
+	})
+	defer reader.Close()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch message from %s: %w", topic, err)
+		}
+
+		if !waitUntilDue(ctx, msg) {
+			return nil
+		}
+
+		var request models.PredictionJobRequest
+		if err := json.Unmarshal(msg.Value, &request); err != nil {
+			// A malformed message will never succeed, so it is skipped.
+			log.Printf("Kafka consumer %d: skipping malformed message at %s/%d/%d: %v", workerID, topic, msg.Partition, msg.Offset, err)
+		} else if !b.handleMessage(ctx, topic, workerID, msg, request, handle) {
+			return nil
+		}
+
+		// The handler has finished, so the offset is committed even when
+		// shutdown has started in the meantime.
+		commitCtx, commitCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = reader.CommitMessages(commitCtx, msg)
+		commitCancel()
+		if err != nil {
+			return fmt.Errorf("failed to commit offset on %s: %w", topic, err)
+		}
+	}
+}
+
+// handleMessage hands request to handle, retrying failures up to
+// kafkaMaxHandleAttempts times before moving the message to the dead-letter
+// topic, so one bad message cannot hold up its partition. It returns false
+// if ctx is cancelled before the message is settled.
+func (b *KafkaBroker) handleMessage(ctx context.Context, topic string, workerID int, msg kafka.Message, request models.PredictionJobRequest, handle func(workerID int, request models.PredictionJobRequest) error) bool {
+	var err error
+	for attempt := 1; attempt <= kafkaMaxHandleAttempts; attempt++ {
+		if err = handle(workerID, request); err == nil {
+			return true
+		}
+
+		log.Printf("Kafka consumer %d: attempt %d/%d of message at %s/%d/%d failed: %v", workerID, attempt, kafkaMaxHandleAttempts, topic, msg.Partition, msg.Offset, err)
+		if !sleepContext(ctx, time.Second) {
+			return false
+		}
+	}
+
+	for {
+		dlqErr := b.DeadLetter(ctx, request, fmt.Sprintf("handler failed %d times: %v", kafkaMaxHandleAttempts, err))
+		if dlqErr == nil {
+			log.Printf("Kafka consumer %d: moved message at %s/%d/%d to %s", workerID, topic, msg.Partition, msg.Offset, b.deadLetterTopic())
+			return true
+		}
+
+		log.Printf("Kafka consumer %d: %v", workerID, dlqErr)
+		if !sleepContext(ctx, time.Second) {
+			return false
+		}
+	}
+}
+
+func (b *KafkaBroker) Close() error {
+	return b.writer.Close()
+}
+
+// waitUntilDue blocks until the retry-at header of msg has passed. It returns
+// false if ctx is cancelled first.
+func waitUntilDue(ctx context.Context, msg kafka.Message) bool {
+	for _, header := range msg.Headers {
+		if header.Key != kafkaRetryAtHeader {
+			continue
+		}
+
+		retryAt, err := strconv.ParseInt(string(header.Value), 10, 64)
+		if err != nil {
+			return true
+		}
+
+		return sleepContext(ctx, time.Until(time.UnixMilli(retryAt)))
+	}
+
+	return true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// MemoryQueue keeps jobs in process memory. It is meant for local development
+// and demos: jobs are lost on restart and cannot be shared between replicas.
+type MemoryQueue struct {
+	maxRetries  int
+	retryPolicy RetryPolicy
+
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*models.PredictionJob
+}
+
+func NewMemoryQueue(maxRetries int, retryPolicy RetryPolicy) *MemoryQueue {
+	return &MemoryQueue{
+		maxRetries:  maxRetries,
+		retryPolicy: retryPolicy,
+		jobs:        make(map[uuid.UUID]*models.PredictionJob),
+	}
+}
+
+func (q *MemoryQueue) Type() string {
+	return "memory"
+}
+
+func (q *MemoryQueue) Publish(imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error) {
+	now := time.Now()
+	job := &models.PredictionJob{
+		ID:          uuid.New(),
+		ImageID:     imageID,
+		Status:      string(models.JobStatusPending),
+		MaxRetries:  q.maxRetries,
+		Priority:    opts.Priority,
+		ClientID:    opts.ClientID,
+		BatchID:     opts.BatchID,
+		ScheduledAt: now,
+		CreatedAt:   now,
+	}
+
+	q.mu.Lock()
+	q.jobs[job.ID] = job
+	q.mu.Unlock()
+
+	copied := *job
+	return &copied, nil
+}
+
+// PublishTx publishes the job right away; memory jobs are not part of the
+// caller's transaction and survive its rollback.
+func (q *MemoryQueue) PublishTx(tx *sqlx.Tx, imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error) {
+	return q.Publish(imageID, imagePath, opts)
+}
+
+// Claim leases the next due pending job in the same order as DBQueue:
+// priority, then the client's turn, then age.
+func (q *MemoryQueue) Claim(ctx context.Context, workerID string, lease time.Duration) (*models.PredictionJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	running := map[string]int{}
+	now := time.Now()
+	var due []*models.PredictionJob
+	for _, job := range q.jobs {
+		switch {
+		case job.Status == string(models.JobStatusProcessing):
+			running[job.ClientID]++
+		case job.Status == string(models.JobStatusPending) && !job.ScheduledAt.After(now):
+			due = append(due, job)
+		}
+	}
+
+	// A job's turn counts its client's jobs in flight and the client's
+	// older due jobs of the same priority.
+	sort.Slice(due, func(i, j int) bool { return due[i].ScheduledAt.Before(due[j].ScheduledAt) })
+	turns := map[*models.PredictionJob]int{}
+	seen := map[string]int{}
+	for _, job := range due {
+		key := fmt.Sprintf("%d/%s", job.Priority, job.ClientID)
+		seen[key]++
+		turns[job] = seen[key] + running[job.ClientID]
+	}
+
+	var next *models.PredictionJob
+	for _, job := range due {
+		if next == nil || claimsBefore(job, next, turns) {
+			next = job
+		}
+	}
+
+	if next == nil {
+		return nil, nil
+	}
+
+	expires := now.Add(lease)
+	next.Status = string(models.JobStatusProcessing)
+	next.StartedAt = &now
+	next.LockedBy = workerID
+	next.LeaseExpiresAt = &expires
+
+	copied := *next
+	return &copied, nil
+}
+
+func (q *MemoryQueue) RenewLease(jobID uuid.UUID, workerID string, lease time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobID]
+	if !ok || job.Status != string(models.JobStatusProcessing) || job.LockedBy != workerID {
+		return ErrJobLeaseLost
+	}
+
+	expires := time.Now().Add(lease)
+	job.LeaseExpiresAt = &expires
+
+	if job.CancelRequested {
+		return ErrJobCancelled
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Ack(jobID uuid.UUID, workerID string, predictionID uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.held(jobID, workerID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.Status = string(models.JobStatusCompleted)
+	job.PredictionID = &predictionID
+	job.CompletedAt = &now
+	releaseLease(job)
+	return nil
+}
+
+func (q *MemoryQueue) AckCancel(jobID uuid.UUID, workerID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.held(jobID, workerID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.Status = string(models.JobStatusCancelled)
+	job.CompletedAt = &now
+	releaseLease(job)
+	return nil
+}
+
+// held returns the job if workerID still holds its lease. The caller must
+// hold q.mu.
+func (q *MemoryQueue) held(jobID uuid.UUID, workerID string) (*models.PredictionJob, error) {
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != string(models.JobStatusProcessing) || job.LockedBy != workerID {
+		return nil, ErrJobLeaseLost
+	}
+
+	return job, nil
+}
+
+func (q *MemoryQueue) Cancel(jobID uuid.UUID) (*models.PredictionJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	switch job.Status {
+	case string(models.JobStatusPending):
+		now := time.Now()
+		job.Status = string(models.JobStatusCancelled)
+		job.CompletedAt = &now
+	case string(models.JobStatusProcessing):
+	default:
+		return nil, ErrJobFinished
+	}
+	job.CancelRequested = true
+
+	copied := *job
+	return &copied, nil
+}
+
+func (q *MemoryQueue) Update(jobID uuid.UUID, update models.JobUpdate) (*models.PredictionJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	if job.Status != string(models.JobStatusPending) {
+		return nil, ErrJobNotPending
+	}
+
+	if update.Priority != nil {
+		job.Priority = *update.Priority
+	}
+	if update.ScheduledAt != nil {
+		job.ScheduledAt = *update.ScheduledAt
+	}
+
+	copied := *job
+	return &copied, nil
+}
+
+func (q *MemoryQueue) Nack(job *models.PredictionJob, reason string, retryable bool) (models.JobStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stored, err := q.held(job.ID, job.LockedBy)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	stored.ErrorMessage = reason
+	releaseLease(stored)
+
+	if !retryable || stored.RetryCount >= stored.MaxRetries {
+		stored.Status = string(models.JobStatusDeadLetter)
+		stored.CompletedAt = &now
+		return models.JobStatusDeadLetter, nil
+	}
+
+	stored.Status = string(models.JobStatusPending)
+	stored.ScheduledAt = now.Add(q.retryPolicy.Delay(stored.RetryCount))
+	stored.RetryCount++
+	stored.StartedAt = nil
+	return models.JobStatusPending, nil
+}
+
+func (q *MemoryQueue) SetPrediction(jobID, predictionID uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	job.PredictionID = &predictionID
+	return nil
+}
+
+func (q *MemoryQueue) ReapExpired() (int, int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	requeued, deadLettered := 0, 0
+	for _, job := range q.jobs {
+		if job.Status != string(models.JobStatusProcessing) || job.LeaseExpiresAt == nil || job.LeaseExpiresAt.After(now) {
+			continue
+		}
+
+		job.ErrorMessage = "lease expired while held by " + job.LockedBy
+		releaseLease(job)
+
+		if job.CancelRequested {
+			job.Status = string(models.JobStatusCancelled)
+			job.CompletedAt = &now
+		} else if job.RetryCount < job.MaxRetries {
+			job.Status = string(models.JobStatusPending)
+			job.RetryCount++
+			job.ScheduledAt = now
+			job.StartedAt = nil
+			requeued++
+		} else {
+			job.Status = string(models.JobStatusDeadLetter)
+			job.CompletedAt = &now
+			deadLettered++
+		}
+	}
+
+	return requeued, deadLettered, nil
+}
+
+func (q *MemoryQueue) Get(jobID uuid.UUID) (*models.PredictionJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	copied := *job
+	return &copied, nil
+}
+
+func (q *MemoryQueue) ListByBatch(batchID uuid.UUID) ([]models.PredictionJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []models.PredictionJob
+	for _, job := range q.jobs {
+		if job.BatchID != nil && *job.BatchID == batchID {
+			jobs = append(jobs, *job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	return jobs, nil
+}
+
+func (q *MemoryQueue) ListDeadLetter(limit, offset int) ([]models.PredictionJob, int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []models.PredictionJob
+	for _, job := range q.jobs {
+		if job.Status == string(models.JobStatusDeadLetter) {
+			jobs = append(jobs, *job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CompletedAt.After(*jobs[j].CompletedAt)
+	})
+
+	total := len(jobs)
+	if offset >= total {
+		return []models.PredictionJob{}, total, nil
+	}
+
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return jobs[offset:end], total, nil
+}
+
+func (q *MemoryQueue) Requeue(jobID uuid.UUID) (*models.PredictionJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobID]
+	if !ok || job.Status != string(models.JobStatusDeadLetter) {
+		return nil, ErrJobNotFound
+	}
+
+	job.Status = string(models.JobStatusPending)
+	job.RetryCount = 0
+	job.ErrorMessage = ""
+	job.CancelRequested = false
+	job.ScheduledAt = time.Now()
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	job.PredictionID = nil
+
+	copied := *job
+	return &copied, nil
+}
+
+func (q *MemoryQueue) Stats() (map[string]interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, job := range q.jobs {
+		counts[job.Status]++
+	}
+
+	return map[string]interface{}{
+		"backend":     q.Type(),
+		"total":       len(q.jobs),
+		"pending":     counts[string(models.JobStatusPending)],
+		"processing":  counts[string(models.JobStatusProcessing)],
+		"completed":   counts[string(models.JobStatusCompleted)],
+		"failed":      counts[string(models.JobStatusFailed)],
+		"dead_letter": counts[string(models.JobStatusDeadLetter)],
+		"cancelled":   counts[string(models.JobStatusCancelled)],
+	}, nil
+}
+
+func (q *MemoryQueue) Close() error {
+	return nil
+}
+
+func claimsBefore(a, b *models.PredictionJob, turns map[*models.PredictionJob]int) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if turns[a] != turns[b] {
+		return turns[a] < turns[b]
+	}
+	return a.ScheduledAt.Before(b.ScheduledAt)
+}
+
+func releaseLease(job *models.PredictionJob) {
+	job.LockedBy = ""
+	job.LeaseExpiresAt = nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func publishJob(t *testing.T, q *MemoryQueue, opts models.JobOptions) *models.PredictionJob {
+	t.Helper()
+
+	job, err := q.Publish(uuid.New(), "", opts)
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	// Keeps ScheduledAt strictly increasing, so ties never decide the order.
+	time.Sleep(time.Millisecond)
+	return job
+}
+
+func TestMemoryQueueClaimsByPriorityThenClientTurn(t *testing.T) {
+	q := NewMemoryQueue(3, RetryPolicy{})
+
+	a1 := publishJob(t, q, models.JobOptions{ClientID: "a"})
+	a2 := publishJob(t, q, models.JobOptions{ClientID: "a"})
+	a3 := publishJob(t, q, models.JobOptions{ClientID: "a"})
+	b1 := publishJob(t, q, models.JobOptions{ClientID: "b"})
+	urgent := publishJob(t, q, models.JobOptions{ClientID: "a", Priority: 5})
+
+	// Client a already runs the urgent job, so b's only job goes before
+	// a's backlog.
+	want := []uuid.UUID{urgent.ID, b1.ID, a1.ID, a2.ID, a3.ID}
+	for i, wantID := range want {
+		job, err := q.Claim(context.Background(), "worker", time.Minute)
+		if err != nil {
+			t.Fatalf("Claim %d: %v", i, err)
+		}
+		if job == nil {
+			t.Fatalf("Claim %d: no job, want %s", i, wantID)
+		}
+		if job.ID != wantID {
+			t.Fatalf("Claim %d: got job %s, want %s", i, job.ID, wantID)
+		}
+	}
+
+	job, err := q.Claim(context.Background(), "worker", time.Minute)
+	if err != nil || job != nil {
+		t.Fatalf("Claim on an empty queue = %v, %v; want nil, nil", job, err)
+	}
+}
+
+func TestMemoryQueueNackBacksOffThenDeadLetters(t *testing.T) {
+	q := NewMemoryQueue(1, RetryPolicy{BaseDelay: time.Hour})
+	published := publishJob(t, q, models.JobOptions{})
+
+	job, _ := q.Claim(context.Background(), "worker", time.Minute)
+	status, err := q.Nack(job, "ML service unavailable", true)
+	if err != nil || status != models.JobStatusPending {
+		t.Fatalf("first Nack = %s, %v; want pending", status, err)
+	}
+
+	stored, _ := q.Get(published.ID)
+	if stored.RetryCount != 1 {
+		t.Errorf("RetryCount = %d, want 1", stored.RetryCount)
+	}
+	if !stored.ScheduledAt.After(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("retry scheduled at %v, want about an hour from now", stored.ScheduledAt)
+	}
+	if job, _ := q.Claim(context.Background(), "worker", time.Minute); job != nil {
+		t.Fatal("claimed a job that is backing off")
+	}
+
+	// Make the retry due and exhaust it.
+	q.jobs[published.ID].ScheduledAt = time.Now()
+	job, _ = q.Claim(context.Background(), "worker", time.Minute)
+	status, err = q.Nack(job, "ML service unavailable", true)
+	if err != nil || status != models.JobStatusDeadLetter {
+		t.Fatalf("second Nack = %s, %v; want dead_letter", status, err)
+	}
+
+	dead, total, _ := q.ListDeadLetter(10, 0)
+	if total != 1 || dead[0].ID != published.ID {
+		t.Errorf("dead letters = %v (total %d), want job %s", dead, total, published.ID)
+	}
+}
+
+func TestMemoryQueueReapsExpiredLeases(t *testing.T) {
+	q := NewMemoryQueue(1, RetryPolicy{})
+	published := publishJob(t, q, models.JobOptions{})
+
+	job, _ := q.Claim(context.Background(), "crashed", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	requeued, deadLettered, err := q.ReapExpired()
+	if err != nil || requeued != 1 || deadLettered != 0 {
+		t.Fatalf("ReapExpired = %d, %d, %v; want 1 requeued", requeued, deadLettered, err)
+	}
+
+	if err := q.Ack(job.ID, "crashed", uuid.New()); !errors.Is(err, ErrJobLeaseLost) {
+		t.Errorf("Ack by the reaped worker = %v, want ErrJobLeaseLost", err)
+	}
+	if err := q.RenewLease(job.ID, "crashed", time.Minute); !errors.Is(err, ErrJobLeaseLost) {
+		t.Errorf("RenewLease by the reaped worker = %v, want ErrJobLeaseLost", err)
+	}
+
+	// The retry budget is spent now, so the next expiry dead-letters.
+	q.Claim(context.Background(), "crashed-again", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	requeued, deadLettered, _ = q.ReapExpired()
+	if requeued != 0 || deadLettered != 1 {
+		t.Fatalf("second ReapExpired = %d, %d; want 1 dead-lettered", requeued, deadLettered)
+	}
+	stored, _ := q.Get(published.ID)
+	if stored.Status != string(models.JobStatusDeadLetter) {
+		t.Errorf("status = %s, want dead_letter", stored.Status)
+	}
+}
+
+func TestMemoryQueueRequeueResetsDeadLetteredJob(t *testing.T) {
+	q := NewMemoryQueue(0, RetryPolicy{})
+	published := publishJob(t, q, models.JobOptions{})
+
+	if _, err := q.Requeue(published.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("Requeue of a pending job = %v, want ErrJobNotFound", err)
+	}
+
+	job, _ := q.Claim(context.Background(), "worker", time.Minute)
+	q.jobs[job.ID].CancelRequested = true
+	if status, err := q.Nack(job, "ML service unavailable", true); err != nil || status != models.JobStatusDeadLetter {
+		t.Fatalf("Nack = %s, %v; want dead_letter", status, err)
+	}
+
+	requeued, err := q.Requeue(published.ID)
+	if err != nil {
+		t.Fatalf("Requeue: %v", err)
+	}
+	if requeued.Status != string(models.JobStatusPending) || requeued.RetryCount != 0 {
+		t.Errorf("requeued job is %s with %d retries, want pending with 0", requeued.Status, requeued.RetryCount)
+	}
+	if requeued.ErrorMessage != "" || requeued.CancelRequested {
+		t.Errorf("requeued job kept ErrorMessage %q and CancelRequested %v from the old attempt", requeued.ErrorMessage, requeued.CancelRequested)
+	}
+}
+
+func memoryQueueFixture() queueFixture {
+	q := NewMemoryQueue(3, RetryPolicy{})
+	return queueFixture{
+		queue:    q,
+		newImage: func(t *testing.T) uuid.UUID { return uuid.New() },
+		process: func(t *testing.T, job *models.PredictionJob) string {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+
+			expires := time.Now().Add(time.Minute)
+			stored := q.jobs[job.ID]
+			stored.Status = string(models.JobStatusProcessing)
+			stored.LockedBy = "worker"
+			stored.LeaseExpiresAt = &expires
+			return "worker"
+		},
+	}
+}
+
+func TestMemoryQueueCancel(t *testing.T) {
+	testQueueCancel(t, memoryQueueFixture())
+}
+
+func TestMemoryQueueUpdate(t *testing.T) {
+	testQueueUpdate(t, memoryQueueFixture())
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"bufio"
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Cassette modes. In record mode every ML call is made as usual and appended
+// to the cassette; in replay mode the ML service is never called and answers
+// come from the cassette instead.
+const (
+	CassetteOff    = "off"
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// ErrCassetteMiss is returned in replay mode for a call the cassette has no
+// answer for. It is permanent: replaying the call again cannot succeed.
+var ErrCassetteMiss = errors.New("no recorded ML answer")
+
+// cassetteEntry is one recorded ML call, stored as a line of JSON.
+type cassetteEntry struct {
+	ImageHash     string                       `json:"image_hash"`
+	ImagePath     string                       `json:"image_path"`
+	Endpoint      string                       `json:"endpoint"`
+	ModelVersion  string                       `json:"model_version"`
+	StatusCode    int                          `json:"status_code,omitempty"`
+	Response      *models.MLPredictionResponse `json:"response,omitempty"`
+	FailureReason string                       `json:"failure_reason,omitempty"`
+	Error         string                       `json:"error,omitempty"`
+	ErrorStatus   int                          `json:"error_status,omitempty"`
+	LatencyMs     int64                        `json:"latency_ms"`
+	RecordedAt    time.Time                    `json:"recorded_at"`
+}
+
+// MLCassette records ML calls to a JSON lines file or replays them from it.
+// Calls are keyed by the SHA-256 of the image and the model version of the
+// endpoint they were sent to; repeated calls with the same key replay the
+// recorded answers in order and then keep repeating the last one, so a
+// recorded retry sequence (503, then 200) replays the same way.
+type MLCassette struct {
+	mode string
+	path string
+
+	mu       sync.Mutex
+	file     *os.File
+	entries  map[string][]cassetteEntry
+	byPath   map[string][]cassetteEntry
+	position map[string]int
+}
+
+// NewMLCassette opens the cassette at path for mode. Record mode appends to
+// an existing cassette; replay mode loads it completely.
+func NewMLCassette(mode string, path string) (*MLCassette, error) {
+	cassette := &MLCassette{
+		mode:     mode,
+		path:     path,
+		entries:  map[string][]cassetteEntry{},
+		byPath:   map[string][]cassetteEntry{},
+		position: map[string]int{},
+	}
+
+	switch mode {
+	case CassetteRecord:
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open ML cassette: %w", err)
+		}
+		cassette.file = file
+	case CassetteReplay:
+		if err := cassette.load(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown ML cassette mode %q", mode)
+	}
+
+	return cassette, nil
+}
+
+func (c *MLCassette) Mode() string {
+	return c.mode
+}
+
+// Close closes the cassette file in record mode.
+func (c *MLCassette) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func (c *MLCassette) load() error {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to open ML cassette: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			var entry cassetteEntry
+			if jsonErr := json.Unmarshal(data, &entry); jsonErr != nil {
+				return fmt.Errorf("failed to parse ML cassette line %d: %w", line, jsonErr)
+			}
+
+			key := cassetteKey(entry.ImageHash, entry.ModelVersion)
+			c.entries[key] = append(c.entries[key], entry)
+			pathKey := cassetteKey(entry.ImagePath, entry.ModelVersion)
+			c.byPath[pathKey] = append(c.byPath[pathKey], entry)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read ML cassette: %w", err)
+		}
+	}
+}
+
+// record appends a finished call to the cassette.
+func (c *MLCassette) record(endpoint config.MLEndpoint, imagePath string, result *models.MLPredictionResponse, err error, latency time.Duration) error {
+	// An unreadable image is still recorded; it replays by path only.
+	hash, _ := hashFile(imagePath)
+
+	entry := cassetteEntry{
+		ImageHash:    hash,
+		ImagePath:    imagePath,
+		Endpoint:     endpoint.Name,
+		ModelVersion: endpoint.ModelVersion,
+		LatencyMs:    latency.Milliseconds(),
+		RecordedAt:   time.Now(),
+	}
+	if result != nil {
+		entry.StatusCode = result.StatusCode
+		entry.Response = result
+		entry.FailureReason = result.FailureReason
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		var mlErr *MLError
+		if errors.As(err, &mlErr) {
+			entry.Error = mlErr.Message
+			entry.ErrorStatus = mlErr.StatusCode
+		}
+	}
+
+	data, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		return fmt.Errorf("failed to encode ML cassette entry: %w", marshalErr)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return errors.New("ML cassette is closed")
+	}
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write ML cassette entry: %w", err)
+	}
+
+	return nil
+}
+
+// replay returns the next recorded answer for the image at imagePath sent to
+// endpoint. Images that cannot be read are matched by path instead of by
+// content, so cassettes can be replayed without the original files.
+func (c *MLCassette) replay(endpoint config.MLEndpoint, imagePath string) (*models.MLPredictionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var key string
+	var entries []cassetteEntry
+	if hash, err := hashFile(imagePath); err == nil {
+		key = cassetteKey(hash, endpoint.ModelVersion)
+		entries = c.entries[key]
+	}
+	if len(entries) == 0 {
+		key = cassetteKey(imagePath, endpoint.ModelVersion)
+		entries = c.byPath[key]
+		key = "path:" + key
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w for %s (model version %q)", ErrCassetteMiss, imagePath, endpoint.ModelVersion)
+	}
+
+	position := c.position[key]
+	if position < len(entries)-1 {
+		c.position[key] = position + 1
+	}
+	entry := entries[position]
+
+	if entry.Response == nil {
+		if entry.ErrorStatus != 0 {
+			return nil, &MLError{StatusCode: entry.ErrorStatus, Message: entry.Error}
+		}
+		return nil, errors.New(entry.Error)
+	}
+
+	result := *entry.Response
+	result.StatusCode = entry.StatusCode
+	result.FailureReason = entry.FailureReason
+	result.Variant = endpoint.Name
+	return &result, nil
+}
+
+func cassetteKey(image, modelVersion string) string {
+	return image + "|" + modelVersion
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
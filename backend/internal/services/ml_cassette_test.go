@@ -0,0 +1,122 @@
+package services
+
+import (
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/mlfake"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newCassetteClient calls the fake ML service at url through a cassette at
+// path.
+func newCassetteClient(t *testing.T, url, mode, path string, maxRetries int) *MLClient {
+	t.Helper()
+
+	cassette, err := NewMLCassette(mode, path)
+	if err != nil {
+		t.Fatalf("NewMLCassette(%s): %v", mode, err)
+	}
+	client := NewMLClient(
+		[]config.MLEndpoint{{Name: "default", URL: url, Weight: 100}},
+		5*time.Second, "", MLTransportPath, maxRetries, RetryPolicy{BaseDelay: time.Millisecond},
+		HedgePolicy{}, 5, time.Minute, cassette,
+	)
+	t.Cleanup(func() {
+		client.Close()
+		cassette.Close()
+	})
+	return client
+}
+
+func TestMLCassetteReplaysRecordedCalls(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "ml.jsonl")
+	retried := writeTestImage(t, "retried.jpg")
+	dirty := writeTestImage(t, "dirty.jpg")
+	if err := os.WriteFile(dirty, []byte("dirty car"), 0o644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	// Never written, so it can only be matched by path.
+	gone := filepath.Join(t.TempDir(), "gone.jpg")
+
+	fake, server := mlfake.Start(mlfake.Script{Rules: []mlfake.Rule{
+		{Match: "dirty", Response: mlfake.Response{Cleanliness: "dirty"}},
+		{Match: "gone", Response: mlfake.Response{Integrity: "damaged"}},
+	}})
+	fake.Enqueue(mlfake.Response{StatusCode: 503, Error: "model is loading"})
+
+	recorder := newCassetteClient(t, server.URL, CassetteRecord, cassettePath, 1)
+	for _, path := range []string{retried, dirty, gone} {
+		result, err := recorder.PredictCarStatus(context.Background(), uuid.New(), path)
+		if err != nil || !result.Success {
+			t.Fatalf("recording %s: %+v, %v; want success", path, result, err)
+		}
+	}
+	recorder.Close()
+	server.Close()
+	if got := len(fake.Requests()); got != 4 {
+		t.Fatalf("fake got %d requests while recording, want 4", got)
+	}
+
+	// Replay never reaches the ML service.
+	replayFake, replayServer := mlfake.Start(mlfake.Script{})
+	t.Cleanup(replayServer.Close)
+	player := newCassetteClient(t, replayServer.URL, CassetteReplay, cassettePath, 0)
+
+	imageID := uuid.New()
+	if version := player.ModelVersionFor(imageID); version != "" {
+		t.Fatalf("ModelVersionFor before any answer = %q, want empty", version)
+	}
+
+	// The recorded retry sequence replays in order: the 503, then the
+	// answer, which keeps repeating.
+	result, err := player.PredictCarStatus(context.Background(), imageID, retried)
+	if mlErr := ClassifyMLFailure(result, err); mlErr == nil || mlErr.StatusCode != 503 {
+		t.Fatalf("first replay: %+v, %v; want the recorded 503", result, err)
+	}
+	for i := 0; i < 2; i++ {
+		result, err = player.PredictCarStatus(context.Background(), imageID, retried)
+		if err != nil || !result.Success || result.Variant != "default" {
+			t.Fatalf("replay %d: %+v, %v; want success from default", i+2, result, err)
+		}
+	}
+	if version := player.ModelVersionFor(imageID); version != "v1.0" {
+		t.Errorf("ModelVersionFor after replay = %q, want the replayed v1.0", version)
+	}
+
+	// A copy of a recorded image matches by content.
+	copied := filepath.Join(t.TempDir(), "copy.jpg")
+	if err := os.WriteFile(copied, []byte("dirty car"), 0o644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	result, err = player.PredictCarStatus(context.Background(), uuid.New(), copied)
+	if err != nil || result.Cleanliness.Status != "dirty" {
+		t.Errorf("replaying by content: %+v, %v; want the dirty answer", result, err)
+	}
+
+	result, err = player.PredictCarStatus(context.Background(), uuid.New(), gone)
+	if err != nil || result.Integrity.Status != "damaged" {
+		t.Errorf("replaying by path: %+v, %v; want the damaged answer", result, err)
+	}
+
+	unknown := writeTestImage(t, "unknown.jpg")
+	if err := os.WriteFile(unknown, []byte("never recorded"), 0o644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	result, err = player.PredictCarStatus(context.Background(), uuid.New(), unknown)
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("replaying an unknown image: %+v, %v; want ErrCassetteMiss", result, err)
+	}
+	if mlErr := ClassifyMLFailure(result, err); mlErr == nil || mlErr.Retryable {
+		t.Errorf("ClassifyMLFailure = %v, want a permanent failure", mlErr)
+	}
+
+	if got := len(replayFake.Requests()); got != 0 {
+		t.Errorf("replay sent %d requests to the ML service, want none", got)
+	}
+}
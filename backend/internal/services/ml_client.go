@@ -2,46 +2,215 @@ package services
 
 import (
 	"bytes"
+	"car-status-backend/internal/config"
 	"car-status-backend/internal/models"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+// ML transports select how PredictCarStatus hands the image to the ML
+// service. MLTransportPath sends only the file path and needs a volume shared
+// with the ML service; MLTransportMultipart uploads the file itself;
+// MLTransportGRPC sends the image bytes as image_data over a persistent gRPC
+// connection, so it needs no shared volume either.
+const (
+	MLTransportPath      = "path"
+	MLTransportMultipart = "multipart"
+	MLTransportGRPC      = "grpc"
 )
 
 type MLClient struct {
-	baseURL    string
-	httpClient *http.Client
-	apiKey     string
+	router      *mlRouter
+	httpClient  *http.Client
+	timeout     time.Duration
+	apiKey      string
+	transport   string
+	maxRetries  int
+	retryPolicy RetryPolicy
+	hedgePolicy HedgePolicy
+	cassette    *MLCassette
+
+	hedged     atomic.Int64
+	replicaWon atomic.Int64
+
+	grpcMu    sync.Mutex
+	grpcConns map[string]*grpc.ClientConn
 }
 
-func NewMLClient(baseURL string, timeout time.Duration, apiKey string) *MLClient {
+// NewMLClient creates the ML service client for one or more endpoints.
+// Calls that fail because an endpoint is unavailable are retried up to
+// maxRetries times with retryPolicy backoff, and count toward that endpoint's
+// circuit breaker, which opens after breakerThreshold consecutive failures
+// and fails calls fast for breakerOpenTimeout. Slow calls are hedged to a
+// replica as hedgePolicy says. A non-nil cassette records every call or
+// replays recorded answers instead of calling the service.
+func NewMLClient(endpoints []config.MLEndpoint, timeout time.Duration, apiKey string, transport string, maxRetries int, retryPolicy RetryPolicy, hedgePolicy HedgePolicy, breakerThreshold int, breakerOpenTimeout time.Duration, cassette *MLCassette) *MLClient {
+	if transport == "" {
+		transport = MLTransportPath
+	}
+
 	return &MLClient{
-		baseURL: baseURL,
+		router: newMLRouter(endpoints, breakerThreshold, breakerOpenTimeout),
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
-		apiKey: apiKey,
+		timeout:     timeout,
+		apiKey:      apiKey,
+		transport:   transport,
+		maxRetries:  maxRetries,
+		retryPolicy: retryPolicy,
+		hedgePolicy: hedgePolicy,
+		cassette:    cassette,
+		grpcConns:   map[string]*grpc.ClientConn{},
 	}
 }
 
-func (c *MLClient) PredictCarStatus(imagePath string) (*models.MLPredictionResponse, error) {
-	fmt.Printf("DEBUG: ML Client sending imagePath: %v\n", imagePath)
-	payload := models.MLPredictionRequest{
-		ImagePath: imagePath,
+// PredictCarStatus asks the ML endpoint that imageID is routed to for a
+// prediction and records the endpoint name in the result's Variant. It
+// returns an error wrapping ErrCircuitOpen without calling the endpoint while
+// its circuit breaker is open. Cancelling ctx aborts the request and any
+// pending retry.
+func (c *MLClient) PredictCarStatus(ctx context.Context, imageID uuid.UUID, imagePath string) (*models.MLPredictionResponse, error) {
+	return c.predict(ctx, c.router.route(imageID), imagePath)
+}
+
+// PredictWithEndpoint is PredictCarStatus against the named endpoint instead
+// of the routed one.
+func (c *MLClient) PredictWithEndpoint(ctx context.Context, name string, imagePath string) (*models.MLPredictionResponse, error) {
+	endpoint := c.router.find(name)
+	if endpoint == nil {
+		return nil, fmt.Errorf("unknown ML endpoint %q", name)
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	return c.predict(ctx, endpoint, imagePath)
+}
+
+func (c *MLClient) predict(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*models.MLPredictionResponse, error) {
+	return c.predictFrom(ctx, endpoint, imagePath, 0)
+}
+
+// predictFrom runs the attempts of predict from first on. A first attempt
+// above 0 continues a call whose earlier attempts were made elsewhere, such
+// as in a PredictBatch stream, after the backoff of the last one.
+func (c *MLClient) predictFrom(ctx context.Context, endpoint *mlEndpoint, imagePath string, first int) (*models.MLPredictionResponse, error) {
+	for attempt := first; ; attempt++ {
+		if attempt > 0 {
+			delay := c.retryPolicy.Delay(attempt - 1)
+			log.Printf("ML service call for %s failed (attempt %d/%d), retrying in %s", imagePath, attempt, c.maxRetries+1, delay)
+			if !sleepContext(ctx, delay) {
+				return nil, fmt.Errorf("ML request cancelled: %w", ctx.Err())
+			}
+		}
+
+		if err := endpoint.breaker.Allow(); err != nil {
+			return nil, fmt.Errorf("failed to send request to %s: %w", endpoint.Name, err)
+		}
+
+		result, err := c.attempt(ctx, endpoint, imagePath)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ML request cancelled: %w", ctx.Err())
+		}
+		if !isServiceFailure(result, err) {
+			return result, err
+		}
+
+		if attempt >= c.maxRetries {
+			return result, err
+		}
+	}
+}
+
+// VariantFor returns the name of the endpoint imageID is routed to.
+func (c *MLClient) VariantFor(imageID uuid.UUID) string {
+	return c.router.route(imageID).Name
+}
+
+// ModelVersionFor returns the model version of the endpoint imageID is routed
+// to: the configured one, else the one the endpoint last reported. It is
+// empty until an endpoint without a pinned version has answered.
+func (c *MLClient) ModelVersionFor(imageID uuid.UUID) string {
+	endpoint := c.router.route(imageID)
+	if endpoint.ModelVersion != "" {
+		return endpoint.ModelVersion
+	}
+	return endpoint.reportedVersion()
+}
+
+// Endpoints returns the configured ML endpoints.
+func (c *MLClient) Endpoints() []config.MLEndpoint {
+	endpoints := make([]config.MLEndpoint, len(c.router.endpoints))
+	for i, endpoint := range c.router.endpoints {
+		endpoints[i] = endpoint.MLEndpoint
+	}
+	return endpoints
+}
+
+// BreakerState reports the circuit breaker state of the named endpoint for
+// health checks.
+func (c *MLClient) BreakerState(name string) (string, time.Duration) {
+	endpoint := c.router.find(name)
+	if endpoint == nil {
+		return CircuitClosed, 0
 	}
+	return endpoint.breaker.State()
+}
 
-	req, err := http.NewRequest("POST", c.baseURL+"/api/predict", bytes.NewBuffer(jsonData))
+// call makes one ML call, through the cassette if there is one.
+func (c *MLClient) call(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*models.MLPredictionResponse, error) {
+	if c.cassette == nil {
+		return c.predictOnce(ctx, endpoint, imagePath)
+	}
+
+	if c.cassette.Mode() == CassetteReplay {
+		result, err := c.cassette.replay(endpoint.MLEndpoint, imagePath)
+		if result != nil && result.Success {
+			// Like a live answer, so ModelVersionFor and the prediction
+			// cache see the replayed model version.
+			endpoint.reported.Store(result.ModelVersion)
+		}
+		return result, err
+	}
+
+	start := time.Now()
+	result, err := c.predictOnce(ctx, endpoint, imagePath)
+	if ctx.Err() == nil {
+		if recordErr := c.cassette.record(endpoint.MLEndpoint, imagePath, result, err, time.Since(start)); recordErr != nil {
+			log.Printf("ML cassette: %v", recordErr)
+		}
+	}
+	return result, err
+}
+
+func (c *MLClient) predictOnce(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*models.MLPredictionResponse, error) {
+	if c.transport == MLTransportGRPC {
+		return c.predictGRPC(ctx, endpoint, imagePath)
+	}
+
+	var req *http.Request
+	var err error
+	if c.transport == MLTransportMultipart {
+		req, err = c.newUploadRequest(ctx, endpoint, imagePath)
+	} else {
+		req, err = c.newPathRequest(ctx, endpoint, imagePath)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
 	if c.apiKey != "" {
 		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
@@ -53,24 +222,158 @@ func (c *MLClient) PredictCarStatus(imagePath string) (*models.MLPredictionRespo
 	defer resp.Body.Close()
 
 	var result models.MLPredictionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+	if decodeErr != nil && resp.StatusCode != http.StatusOK {
+		return nil, &MLError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("ML service returned status %d", resp.StatusCode),
+		}
 	}
+	result.StatusCode = resp.StatusCode
 
-	if resp.StatusCode != http.StatusOK {
+	if decodeErr != nil {
+		result.Variant = endpoint.Name
+		if result.ModelVersion == "" {
+			result.ModelVersion = endpoint.ModelVersion
+		}
+		return rejectMLResponse(&result, &MLValidationError{
+			Reason:  FailureMalformedResponse,
+			Field:   "body",
+			Message: decodeErr.Error(),
+		}), nil
+	}
+
+	return finishResult(endpoint, &result), nil
+}
+
+// finishResult completes a decoded ML answer, whatever the transport: it
+// records the endpoint, fills in its model version if the service did not
+// report one and decides whether the prediction succeeded.
+func finishResult(endpoint *mlEndpoint, result *models.MLPredictionResponse) *models.MLPredictionResponse {
+	result.Variant = endpoint.Name
+	if result.ModelVersion == "" {
+		result.ModelVersion = endpoint.ModelVersion
+	}
+
+	if result.StatusCode != http.StatusOK {
 		result.Success = false
 		if result.Error == "" {
-			result.Error = fmt.Sprintf("ML service returned status %d", resp.StatusCode)
+			result.Error = fmt.Sprintf("ML service returned status %d", result.StatusCode)
 		}
-		return &result, nil
+		return result
+	}
+
+	// A 200 is only a successful prediction once the labels, confidences and
+	// version have been checked; anything else is stored as a failed
+	// prediction instead of tripping the table's CHECK constraints.
+	if validationErr := validateMLResponse(result); validationErr != nil {
+		return rejectMLResponse(result, validationErr)
 	}
 
+	endpoint.reported.Store(result.ModelVersion)
 	result.Success = true
-	return &result, nil
+	return result
 }
 
-func (c *MLClient) HealthCheck() error {
-	req, err := http.NewRequest("GET", c.baseURL+"/health", nil)
+// isServiceFailure reports whether a call failed because the ML service was
+// unreachable or overloaded. Only those failures are retried and trip the
+// circuit breaker; a rejected image says nothing about the service's health.
+func isServiceFailure(result *models.MLPredictionResponse, err error) bool {
+	if errors.Is(err, ErrCassetteMiss) {
+		return false
+	}
+	if err != nil {
+		var mlErr *MLError
+		if errors.As(err, &mlErr) {
+			return isRetryableStatus(mlErr.StatusCode)
+		}
+		return true
+	}
+
+	return result != nil && !result.Success && isRetryableStatus(result.StatusCode)
+}
+
+func (c *MLClient) newPathRequest(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*http.Request, error) {
+	payload := models.MLPredictionRequest{
+		ImagePath:    imagePath,
+		ModelVersion: endpoint.ModelVersion,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.URL+"/api/predict", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// newUploadRequest streams the image as multipart/form-data, so the file is
+// never held in memory as a whole. A missing file is reported like the ML
+// service reports it in path mode, as a permanent 404.
+func (c *MLClient) newUploadRequest(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*http.Request, error) {
+	file, err := os.Open(imagePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &MLError{
+			StatusCode: http.StatusNotFound,
+			Message:    "image file not found: " + imagePath,
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+
+	body, pipe := io.Pipe()
+	form := multipart.NewWriter(pipe)
+
+	go func() {
+		defer file.Close()
+
+		var err error
+		if endpoint.ModelVersion != "" {
+			err = form.WriteField("model_version", endpoint.ModelVersion)
+		}
+
+		var part io.Writer
+		if err == nil {
+			part, err = form.CreateFormFile("file", filepath.Base(imagePath))
+		}
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pipe.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.URL+"/api/predict/upload", body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req, nil
+}
+
+// HealthCheck checks the named endpoint.
+func (c *MLClient) HealthCheck(ctx context.Context, name string) error {
+	endpoint := c.router.find(name)
+	if endpoint == nil {
+		return fmt.Errorf("unknown ML endpoint %q", name)
+	}
+
+	if c.transport == MLTransportGRPC {
+		return c.healthCheckGRPC(ctx, endpoint)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint.URL+"/health", nil)
 	if err != nil {
 		return fmt.Errorf("failed to create health check request: %w", err)
 	}
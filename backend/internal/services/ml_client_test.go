@@ -0,0 +1,355 @@
+package services
+
+import (
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/mlfake"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newFakeMLClient points an MLClient over HTTP at a fresh fake ML service.
+func newFakeMLClient(t *testing.T, script mlfake.Script, maxRetries int, breakerThreshold int) (*MLClient, *mlfake.Server) {
+	t.Helper()
+
+	fake, server := mlfake.Start(script)
+	t.Cleanup(server.Close)
+
+	client := NewMLClient(
+		[]config.MLEndpoint{{Name: "default", URL: server.URL, Weight: 100}},
+		5*time.Second, "", MLTransportPath, maxRetries, RetryPolicy{BaseDelay: time.Millisecond},
+		HedgePolicy{}, breakerThreshold, time.Minute, nil,
+	)
+	t.Cleanup(func() { client.Close() })
+	return client, fake
+}
+
+func writeTestImage(t *testing.T, name string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("jpeg"), 0o644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	return path
+}
+
+func TestMLClientRejectsInvalidResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		response mlfake.Response
+		reason   string
+	}{
+		{"unknown label", mlfake.Response{Cleanliness: "muddy"}, FailureInvalidLabel},
+		{"confidence out of range", mlfake.Response{IntegrityConfidence: 1.5}, FailureInvalidConfidence},
+		{"malformed body", mlfake.Response{RawBody: "<html>oops</html>"}, FailureMalformedResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newFakeMLClient(t, mlfake.Script{Queue: []mlfake.Response{tt.response}}, 2, 1)
+
+			result, err := client.PredictCarStatus(context.Background(), uuid.New(), "/uploads/car.jpg")
+			if err != nil {
+				t.Fatalf("PredictCarStatus: %v", err)
+			}
+			if result.Success || result.FailureReason != tt.reason {
+				t.Fatalf("result = success %v, reason %q; want a rejected %q", result.Success, result.FailureReason, tt.reason)
+			}
+			if mlErr := ClassifyMLFailure(result, err); mlErr == nil || mlErr.Retryable {
+				t.Errorf("ClassifyMLFailure = %v, want a permanent failure", mlErr)
+			}
+			// A bad answer is not an outage: no retry, breaker stays closed.
+			if state, _ := client.BreakerState("default"); state != CircuitClosed {
+				t.Errorf("breaker is %s, want closed", state)
+			}
+		})
+	}
+}
+
+func TestMLClientRetriesThenOpensBreaker(t *testing.T) {
+	client, fake := newFakeMLClient(t, mlfake.Script{}, 2, 3)
+
+	fake.Enqueue(mlfake.Response{StatusCode: 503, Error: "model is loading"})
+	result, err := client.PredictCarStatus(context.Background(), uuid.New(), "/uploads/car.jpg")
+	if err != nil || !result.Success {
+		t.Fatalf("PredictCarStatus = %+v, %v; want success after one retry", result, err)
+	}
+	if got := len(fake.Requests()); got != 2 {
+		t.Fatalf("fake got %d requests, want 2", got)
+	}
+
+	fake.SetScript(mlfake.Script{Default: mlfake.Response{StatusCode: 503, Error: "model is loading"}})
+	fake.Reset()
+	result, err = client.PredictCarStatus(context.Background(), uuid.New(), "/uploads/car.jpg")
+	if mlErr := ClassifyMLFailure(result, err); mlErr == nil || mlErr.StatusCode != 503 {
+		t.Fatalf("PredictCarStatus = %+v, %v; want the 503 after retries", result, err)
+	}
+	if got := len(fake.Requests()); got != 3 {
+		t.Fatalf("fake got %d requests, want 3", got)
+	}
+
+	if state, _ := client.BreakerState("default"); state != CircuitOpen {
+		t.Fatalf("breaker is %s after 3 failures, want open", state)
+	}
+	_, err = client.PredictCarStatus(context.Background(), uuid.New(), "/uploads/car.jpg")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("PredictCarStatus with an open breaker = %v, want ErrCircuitOpen", err)
+	}
+	if got := len(fake.Requests()); got != 3 {
+		t.Errorf("open breaker let a request through: fake got %d requests, want 3", got)
+	}
+}
+
+// newHedgedClient serves one slow and one fast replica of the same model.
+func newHedgedClient(t *testing.T, slowDelay time.Duration) (*MLClient, *mlfake.Server, *mlfake.Server) {
+	t.Helper()
+
+	slow, slowServer := mlfake.Start(mlfake.Script{Default: mlfake.Response{Delay: mlfake.Duration(slowDelay)}})
+	t.Cleanup(slowServer.Close)
+	fast, fastServer := mlfake.Start(mlfake.Script{})
+	t.Cleanup(fastServer.Close)
+
+	client := NewMLClient(
+		[]config.MLEndpoint{
+			{Name: "slow", URL: slowServer.URL, ModelVersion: "v1.0", Weight: 50},
+			{Name: "fast", URL: fastServer.URL, ModelVersion: "v1.0", Weight: 50},
+		},
+		5*time.Second, "", MLTransportPath, 0, RetryPolicy{},
+		HedgePolicy{Percentile: 95, MinDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond},
+		5, time.Minute, nil,
+	)
+	t.Cleanup(func() { client.Close() })
+	return client, slow, fast
+}
+
+func TestMLClientHedgesSlowRequestToReplica(t *testing.T) {
+	client, slow, fast := newHedgedClient(t, 2*time.Second)
+
+	start := time.Now()
+	result, err := client.PredictWithEndpoint(context.Background(), "slow", "/uploads/car.jpg")
+	if err != nil || !result.Success {
+		t.Fatalf("PredictWithEndpoint = %+v, %v; want success", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hedged request took %v, want the fast replica's answer", elapsed)
+	}
+	if result.Variant != "fast" {
+		t.Errorf("answer came from %q, want fast", result.Variant)
+	}
+
+	if len(slow.Requests()) != 1 || len(fast.Requests()) != 1 {
+		t.Errorf("requests: slow %d, fast %d; want one each", len(slow.Requests()), len(fast.Requests()))
+	}
+	if stats := client.HedgeStats(); stats.Hedged != 1 || stats.ReplicaWon != 1 {
+		t.Errorf("HedgeStats = %+v, want 1 hedged and won by the replica", stats)
+	}
+}
+
+func TestMLClientDoesNotHedgeWithoutLimiterSlot(t *testing.T) {
+	client, _, fast := newHedgedClient(t, 200*time.Millisecond)
+
+	limiter := NewMLLimiter(1, 0, time.Second)
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer limiter.Release()
+
+	ctx := WithMLLimiter(context.Background(), limiter)
+	result, err := client.PredictWithEndpoint(ctx, "slow", "/uploads/car.jpg")
+	if err != nil || result.Variant != "slow" {
+		t.Fatalf("PredictWithEndpoint = %+v, %v; want the slow endpoint's answer", result, err)
+	}
+	if len(fast.Requests()) != 0 || client.HedgeStats().Hedged != 0 {
+		t.Error("request was hedged although the limiter had no free slot")
+	}
+}
+
+func TestMLLimiterShedsLoad(t *testing.T) {
+	limiter := NewMLLimiter(1, 1, 20*time.Millisecond)
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	queued := make(chan error)
+	go func() { queued <- limiter.Acquire(context.Background()) }()
+
+	// Wait until the second caller sits in the queue, so the third finds it
+	// full.
+	for limiter.Stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := limiter.Acquire(context.Background()); !errors.Is(err, ErrMLOverloaded) {
+		t.Errorf("Acquire with a full queue = %v, want ErrMLOverloaded", err)
+	}
+	if err := <-queued; !errors.Is(err, ErrMLBusy) {
+		t.Errorf("queued Acquire = %v, want ErrMLBusy", err)
+	}
+
+	stats := limiter.Stats()
+	if stats.Admitted != 1 || stats.RejectedQueueFull != 1 || stats.RejectedTimeout != 1 {
+		t.Errorf("Stats = %+v, want 1 admitted, 1 rejected for a full queue and 1 for timing out", stats)
+	}
+	if limiter.RetryAfter() != time.Second {
+		t.Errorf("RetryAfter = %v, want 1s", limiter.RetryAfter())
+	}
+}
+
+func TestMLClientSendsImageBytesOverGRPC(t *testing.T) {
+	fake, addr, stop := mlfake.StartGRPC(mlfake.Script{})
+	t.Cleanup(stop)
+
+	client := NewMLClient(
+		[]config.MLEndpoint{{Name: "default", URL: addr, Weight: 100}},
+		5*time.Second, "", MLTransportGRPC, 0, RetryPolicy{},
+		HedgePolicy{}, 5, time.Minute, nil,
+	)
+	t.Cleanup(func() { client.Close() })
+
+	// The image exists only on this side; the service gets its bytes.
+	path := writeTestImage(t, "car.jpg")
+	result, err := client.PredictCarStatus(context.Background(), uuid.New(), path)
+	if err != nil || !result.Success {
+		t.Fatalf("PredictCarStatus = %+v, %v; want success", result, err)
+	}
+	if requests := fake.Requests(); len(requests) != 1 || requests[0].Image != "car.jpg" {
+		t.Errorf("requests = %+v, want one for car.jpg", requests)
+	}
+
+	items := []MLBatchItem{
+		{ImageID: uuid.New(), ImagePath: writeTestImage(t, "a.jpg")},
+		{ImageID: uuid.New(), ImagePath: filepath.Join(t.TempDir(), "missing.jpg")},
+		{ImageID: uuid.New(), ImagePath: writeTestImage(t, "b.jpg")},
+	}
+	results := client.PredictBatch(context.Background(), items)
+	for i, want := range []bool{true, false, true} {
+		if results[i].ImageID != items[i].ImageID {
+			t.Fatalf("result %d is for %s, want %s", i, results[i].ImageID, items[i].ImageID)
+		}
+		if ok := ClassifyMLFailure(results[i].Result, results[i].Err) == nil; ok != want {
+			t.Errorf("result %d: success %v, want %v (%+v, %v)", i, ok, want, results[i].Result, results[i].Err)
+		}
+	}
+	if mlErr := ClassifyMLFailure(results[1].Result, results[1].Err); mlErr == nil || mlErr.StatusCode != 404 {
+		t.Errorf("missing image: %v, want a 404", mlErr)
+	}
+}
+
+func TestMLClientUploadsImageAsMultipart(t *testing.T) {
+	fake := mlfake.NewServer(mlfake.Script{})
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The fake reads the already parsed form, so the test can read the
+		// file first.
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			if file, _, err := r.FormFile("file"); err == nil {
+				uploaded, _ = io.ReadAll(file)
+				file.Close()
+			}
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewMLClient(
+		[]config.MLEndpoint{{Name: "v2", URL: server.URL, Weight: 100, ModelVersion: "2.0"}},
+		5*time.Second, "", MLTransportMultipart, 0, RetryPolicy{},
+		HedgePolicy{}, 5, time.Minute, nil,
+	)
+	t.Cleanup(func() { client.Close() })
+
+	result, err := client.PredictCarStatus(context.Background(), uuid.New(), writeTestImage(t, "car.jpg"))
+	if err != nil || !result.Success {
+		t.Fatalf("PredictCarStatus = %+v, %v; want success", result, err)
+	}
+	requests := fake.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("ML service got %d requests, want 1", len(requests))
+	}
+	if requests[0].Path != "/api/predict/upload" || requests[0].Image != "car.jpg" || requests[0].ModelVersion != "2.0" {
+		t.Errorf("request = %+v, want an upload of car.jpg for model 2.0", requests[0])
+	}
+	if string(uploaded) != "jpeg" {
+		t.Errorf("uploaded %q, want the file content", uploaded)
+	}
+
+	// A missing file fails for good without reaching the service.
+	result, err = client.PredictCarStatus(context.Background(), uuid.New(), filepath.Join(t.TempDir(), "missing.jpg"))
+	if mlErr := ClassifyMLFailure(result, err); mlErr == nil || mlErr.Retryable {
+		t.Errorf("missing file: ClassifyMLFailure = %v, want a permanent failure", mlErr)
+	}
+	if got := len(fake.Requests()); got != 1 {
+		t.Errorf("ML service got %d requests, want no new one for a missing file", got)
+	}
+}
+
+// newGRPCClient streams batches to a fresh fake gRPC ML service.
+func newGRPCClient(t *testing.T, script mlfake.Script, maxRetries int, breakerThreshold int) (*MLClient, *mlfake.Server) {
+	t.Helper()
+
+	fake, addr, stop := mlfake.StartGRPC(script)
+	t.Cleanup(stop)
+
+	client := NewMLClient(
+		[]config.MLEndpoint{{Name: "default", URL: addr, Weight: 100}},
+		5*time.Second, "", MLTransportGRPC, maxRetries, RetryPolicy{BaseDelay: time.Millisecond},
+		HedgePolicy{}, breakerThreshold, time.Minute, nil,
+	)
+	t.Cleanup(func() { client.Close() })
+	return client, fake
+}
+
+func batchItems(t *testing.T, n int) []MLBatchItem {
+	items := make([]MLBatchItem, n)
+	for i := range items {
+		items[i] = MLBatchItem{ImageID: uuid.New(), ImagePath: writeTestImage(t, fmt.Sprintf("car%d.jpg", i))}
+	}
+	return items
+}
+
+func TestMLClientBatchItemFailuresTripBreaker(t *testing.T) {
+	client, _ := newGRPCClient(t, mlfake.Script{Default: mlfake.Response{StatusCode: 500, Error: "CUDA out of memory"}}, 0, 2)
+
+	for i, result := range client.PredictBatch(context.Background(), batchItems(t, 2)) {
+		if mlErr := ClassifyMLFailure(result.Result, result.Err); mlErr == nil || mlErr.StatusCode != 500 {
+			t.Errorf("result %d = %+v, %v; want the 500", i, result.Result, result.Err)
+		}
+	}
+	if state, _ := client.BreakerState("default"); state != CircuitOpen {
+		t.Errorf("breaker is %s after two failed images, want open", state)
+	}
+}
+
+func TestMLClientRetriesFailedBatchItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure mlfake.Response
+	}{
+		{"failed image", mlfake.Response{StatusCode: 500, Error: "CUDA out of memory"}},
+		{"broken stream", mlfake.Response{StatusCode: 503, Error: "model is loading"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newGRPCClient(t, mlfake.Script{Queue: []mlfake.Response{tt.failure}}, 1, 5)
+
+			for i, result := range client.PredictBatch(context.Background(), batchItems(t, 3)) {
+				if result.Err != nil || !result.Result.Success {
+					t.Errorf("result %d = %+v, %v; want success after a retry", i, result.Result, result.Err)
+				}
+			}
+			if requests := fake.Requests(); len(requests) < 4 {
+				t.Errorf("fake got %d requests, want the batch and at least one retry", len(requests))
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// MLError describes a failed call to the ML service. Retryable is true for
+// failures that may succeed on a later attempt (timeouts, connection errors,
+// 5xx, 429); 4xx responses such as a missing file (404) or an image the model
+// cannot decode (400) are permanent.
+type MLError struct {
+	StatusCode int
+	Message    string
+	Retryable  bool
+}
+
+func (e *MLError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("ML service error (status %d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("ML service error: %s", e.Message)
+}
+
+// ClassifyMLFailure turns the result of MLClient.PredictCarStatus into an
+// *MLError, or returns nil when the prediction succeeded.
+func ClassifyMLFailure(result *models.MLPredictionResponse, err error) *MLError {
+	if err != nil {
+		var mlErr *MLError
+		if errors.As(err, &mlErr) {
+			mlErr.Retryable = isRetryableStatus(mlErr.StatusCode)
+			return mlErr
+		}
+		if errors.Is(err, ErrCassetteMiss) {
+			return &MLError{Message: err.Error()}
+		}
+		return &MLError{Message: err.Error(), Retryable: true}
+	}
+
+	if result == nil {
+		return &MLError{Message: "empty response", Retryable: true}
+	}
+
+	if result.Success {
+		return nil
+	}
+
+	message := result.Error
+	if message == "" {
+		message = "prediction failed"
+	}
+
+	return &MLError{
+		StatusCode: result.StatusCode,
+		Message:    message,
+		Retryable:  result.StatusCode == 0 || isRetryableStatus(result.StatusCode),
+	}
+}
+
+func isRetryableStatus(statusCode int) bool {
+	switch {
+	case statusCode >= 500:
+		return true
+	case statusCode == http.StatusTooManyRequests, statusCode == http.StatusRequestTimeout:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,393 @@
+package services
+
+import (
+	"car-status-backend/internal/mlpb"
+	"car-status-backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcMaxMessageSize leaves room for the images sent as image_data; uploads
+// are limited to MAX_FILE_SIZE, 10 MB by default.
+const grpcMaxMessageSize = 16 << 20
+
+// MLBatchItem is one image of a PredictBatch call.
+type MLBatchItem struct {
+	ImageID   uuid.UUID
+	ImagePath string
+}
+
+// MLBatchResult is the outcome for one MLBatchItem, with the same meaning as
+// the return values of PredictCarStatus.
+type MLBatchResult struct {
+	ImageID uuid.UUID
+	Result  *models.MLPredictionResponse
+	Err     error
+}
+
+// grpcClient returns the gRPC client for endpoint. Connections are opened on
+// first use and shared by every caller until Close, so workers do not pay a
+// connection setup per prediction.
+func (c *MLClient) grpcClient(endpoint *mlEndpoint) (mlpb.MLServiceClient, error) {
+	c.grpcMu.Lock()
+	defer c.grpcMu.Unlock()
+
+	if conn, ok := c.grpcConns[endpoint.Name]; ok {
+		return mlpb.NewMLServiceClient(conn), nil
+	}
+
+	conn, err := grpc.Dial(
+		grpcTarget(endpoint.URL),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(grpcMaxMessageSize),
+			grpc.MaxCallSendMsgSize(grpcMaxMessageSize),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", endpoint.Name, err)
+	}
+
+	c.grpcConns[endpoint.Name] = conn
+	return mlpb.NewMLServiceClient(conn), nil
+}
+
+// Close closes the gRPC connections opened by the client.
+func (c *MLClient) Close() error {
+	c.grpcMu.Lock()
+	defer c.grpcMu.Unlock()
+
+	var firstErr error
+	for name, conn := range c.grpcConns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.grpcConns, name)
+	}
+	return firstErr
+}
+
+func (c *MLClient) grpcContext(ctx context.Context) context.Context {
+	if c.apiKey == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.apiKey)
+}
+
+func (c *MLClient) predictGRPC(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*models.MLPredictionResponse, error) {
+	client, err := c.grpcClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// The call ends with the caller's context; the configured timeout only
+	// bounds callers that did not set a deadline of their own.
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := newGRPCRequest("", endpoint, imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Predict(c.grpcContext(ctx), req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return finishResult(endpoint, fromGRPCResponse(resp)), nil
+}
+
+func (c *MLClient) healthCheckGRPC(ctx context.Context, endpoint *mlEndpoint) error {
+	client, err := c.grpcClient(endpoint)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Health(c.grpcContext(ctx), &mlpb.HealthRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to perform health check: %w", err)
+	}
+	if resp.GetStatus() != "ok" {
+		return fmt.Errorf("ML service health check reported %q", resp.GetStatus())
+	}
+
+	return nil
+}
+
+// StreamsBatches reports whether PredictBatch streams images over gRPC
+// rather than predicting them one by one.
+func (c *MLClient) StreamsBatches() bool {
+	return c.transport == MLTransportGRPC && c.cassette == nil
+}
+
+// PredictBatch predicts several images at once. Over gRPC the images routed
+// to one endpoint share a single PredictStream call, which is the first
+// attempt of each image and is never hedged. Images that fail it because of
+// the service, including every image left unanswered by a broken stream,
+// get the remaining retries of PredictCarStatus one by one, hedged as usual.
+// Other transports, and cassette mode, predict the images one by one like
+// PredictCarStatus. Results are in the order of items.
+func (c *MLClient) PredictBatch(ctx context.Context, items []MLBatchItem) []MLBatchResult {
+	results := make([]MLBatchResult, len(items))
+	for i, item := range items {
+		results[i].ImageID = item.ImageID
+	}
+
+	if !c.StreamsBatches() {
+		for i, item := range items {
+			results[i].Result, results[i].Err = c.PredictCarStatus(ctx, item.ImageID, item.ImagePath)
+		}
+		return results
+	}
+
+	groups := map[*mlEndpoint][]int{}
+	for i, item := range items {
+		endpoint := c.router.route(item.ImageID)
+		groups[endpoint] = append(groups[endpoint], i)
+	}
+
+	done := make(chan struct{})
+	for endpoint, indexes := range groups {
+		go func(endpoint *mlEndpoint, indexes []int) {
+			defer func() { done <- struct{}{} }()
+			c.streamBatch(ctx, endpoint, items, indexes, results)
+		}(endpoint, indexes)
+	}
+	for range groups {
+		<-done
+	}
+
+	if c.maxRetries == 0 {
+		return results
+	}
+
+	retried := 0
+	for i, item := range items {
+		if ctx.Err() != nil || !isServiceFailure(results[i].Result, results[i].Err) {
+			continue
+		}
+		retried++
+		go func(i int, item MLBatchItem) {
+			defer func() { done <- struct{}{} }()
+			results[i].Result, results[i].Err = c.predictFrom(ctx, c.router.route(item.ImageID), item.ImagePath, 1)
+		}(i, item)
+	}
+	for ; retried > 0; retried-- {
+		<-done
+	}
+
+	return results
+}
+
+// streamBatch sends the items at indexes to endpoint over one stream and
+// fills in their results.
+func (c *MLClient) streamBatch(ctx context.Context, endpoint *mlEndpoint, items []MLBatchItem, indexes []int, results []MLBatchResult) {
+	fail := func(err error) {
+		for _, i := range indexes {
+			if results[i].Result == nil && results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+	}
+
+	if err := endpoint.breaker.Allow(); err != nil {
+		fail(fmt.Errorf("failed to send request to %s: %w", endpoint.Name, err))
+		return
+	}
+
+	client, err := c.grpcClient(endpoint)
+	if err != nil {
+		endpoint.breaker.Failure()
+		fail(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.PredictStream(c.grpcContext(ctx))
+	if err != nil {
+		endpoint.breaker.Failure()
+		fail(grpcError(err))
+		return
+	}
+
+	// answered is whether any image was answered, so the breaker recorded
+	// an outcome.
+	var answered bool
+
+	// Request IDs are item indexes, so duplicate images get their own answer.
+	pending := map[string]int{}
+	for _, i := range indexes {
+		pending[strconv.Itoa(i)] = i
+	}
+
+	// An image that cannot be read fails on its own and is not sent.
+	var requests []*mlpb.PredictRequest
+	for _, i := range indexes {
+		req, err := newGRPCRequest(strconv.Itoa(i), endpoint, items[i].ImagePath)
+		if err != nil {
+			results[i].Err = err
+			delete(pending, strconv.Itoa(i))
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, req := range requests {
+			if err := stream.Send(req); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- stream.CloseSend()
+	}()
+
+	for len(pending) > 0 {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			err = status.Error(codes.Unavailable, "stream closed before all images were answered")
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				endpoint.breaker.Release()
+				fail(fmt.Errorf("ML request cancelled: %w", ctx.Err()))
+				return
+			}
+			endpoint.breaker.Failure()
+			fail(grpcError(err))
+			return
+		}
+
+		i, ok := pending[resp.GetRequestId()]
+		if !ok {
+			continue
+		}
+		delete(pending, resp.GetRequestId())
+		results[i].Result = finishResult(endpoint, fromGRPCResponse(resp))
+
+		// Every answered image counts like a single call would, so an
+		// endpoint failing image after image trips its breaker.
+		if isServiceFailure(results[i].Result, nil) {
+			endpoint.breaker.Failure()
+		} else {
+			endpoint.breaker.Success()
+		}
+		answered = true
+	}
+
+	<-sendErr
+	if !answered {
+		endpoint.breaker.Release()
+	}
+}
+
+// newGRPCRequest builds a request carrying the image content as image_data,
+// so the ML service does not need a volume shared with the backend.
+func newGRPCRequest(requestID string, endpoint *mlEndpoint, imagePath string) (*mlpb.PredictRequest, error) {
+	data, err := os.ReadFile(imagePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &MLError{
+			StatusCode: http.StatusNotFound,
+			Message:    "image file not found: " + imagePath,
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	return &mlpb.PredictRequest{
+		RequestId:    requestID,
+		Image:        &mlpb.PredictRequest_ImageData{ImageData: data},
+		Filename:     filepath.Base(imagePath),
+		ModelVersion: endpoint.ModelVersion,
+	}, nil
+}
+
+func fromGRPCResponse(resp *mlpb.PredictResponse) *models.MLPredictionResponse {
+	var result models.MLPredictionResponse
+	result.Cleanliness.Status = resp.GetCleanliness().GetStatus()
+	result.Cleanliness.Confidence = resp.GetCleanliness().GetConfidence()
+	result.Integrity.Status = resp.GetIntegrity().GetStatus()
+	result.Integrity.Confidence = resp.GetIntegrity().GetConfidence()
+	result.ProcessingTime = int(resp.GetProcessingTimeMs())
+	result.ModelVersion = resp.GetModelVersion()
+	result.Error = resp.GetError()
+
+	// Per-image failures come back as success = false with an HTTP-like
+	// status code, so they are classified like HTTP answers.
+	result.StatusCode = http.StatusOK
+	if !resp.GetSuccess() {
+		result.StatusCode = int(resp.GetStatusCode())
+		if result.StatusCode == 0 || result.StatusCode == http.StatusOK {
+			result.StatusCode = http.StatusInternalServerError
+		}
+	}
+
+	return &result
+}
+
+// grpcError maps a failed RPC to an *MLError with the matching HTTP status,
+// so retries and the circuit breaker treat both transports alike.
+func grpcError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	statusCode := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.Unavailable:
+		statusCode = http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		statusCode = http.StatusGatewayTimeout
+	case codes.ResourceExhausted:
+		statusCode = http.StatusTooManyRequests
+	case codes.InvalidArgument:
+		statusCode = http.StatusBadRequest
+	case codes.NotFound:
+		statusCode = http.StatusNotFound
+	case codes.Unauthenticated:
+		statusCode = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		statusCode = http.StatusForbidden
+	case codes.Unimplemented:
+		statusCode = http.StatusNotImplemented
+	}
+
+	return &MLError{
+		StatusCode: statusCode,
+		Message:    fmt.Sprintf("gRPC %s: %s", st.Code(), st.Message()),
+	}
+}
+
+// grpcTarget turns an endpoint URL into a gRPC dial target, accepting
+// "grpc://host:port" and plain "host:port".
+func grpcTarget(url string) string {
+	for _, scheme := range []string{"grpc://", "http://"} {
+		if strings.HasPrefix(url, scheme) {
+			return strings.TrimSuffix(strings.TrimPrefix(url, scheme), "/")
+		}
+	}
+	return url
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindowSize is how many recent answers the hedge delay is
+	// computed from.
+	latencyWindowSize = 256
+	// hedgeMinSamples answers are needed before the percentile is trusted;
+	// until then the hedge delay is MaxDelay.
+	hedgeMinSamples = 20
+)
+
+// HedgePolicy configures hedged requests. When an endpoint has not answered
+// within the Percentile (0..100) of recent answer latencies, clamped to
+// MinDelay..MaxDelay, the same request is also sent to a replica: another
+// endpoint in rotation with the same model version. A zero Percentile turns
+// hedging off.
+type HedgePolicy struct {
+	Percentile float64
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+}
+
+// HedgeStats counts hedged requests for the stats endpoint.
+type HedgeStats struct {
+	Percentile float64 `json:"percentile"`
+	Hedged     int64   `json:"hedged"`
+	ReplicaWon int64   `json:"replica_won"`
+}
+
+// latencyWindow keeps the latencies of the last answers of one model version,
+// whichever replica gave them.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// percentile returns the p-th percentile of the window, or false while it
+// holds fewer than hedgeMinSamples answers.
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	w.mu.Lock()
+	samples := make([]time.Duration, len(w.samples))
+	copy(samples, w.samples)
+	w.mu.Unlock()
+
+	if len(samples) < hedgeMinSamples {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	rank := int(math.Ceil(p/100*float64(len(samples)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(samples) {
+		rank = len(samples) - 1
+	}
+	return samples[rank], true
+}
+
+type hedgeAnswer struct {
+	endpoint *mlEndpoint
+	result   *models.MLPredictionResponse
+	err      error
+}
+
+// HedgeStats reports how many requests were hedged and how many of them the
+// replica answered first.
+func (c *MLClient) HedgeStats() HedgeStats {
+	return HedgeStats{
+		Percentile: c.hedgePolicy.Percentile,
+		Hedged:     c.hedged.Load(),
+		ReplicaWon: c.replicaWon.Load(),
+	}
+}
+
+// HedgingEnabled reports whether the client hedges slow requests.
+func (c *MLClient) HedgingEnabled() bool {
+	return c.hedgePolicy.Percentile > 0
+}
+
+// attempt makes one try at a prediction on endpoint, whose breaker has
+// allowed it, hedging it to a replica if endpoint is slow. The first answer
+// that is not a service failure wins and the other call is cancelled. Every
+// call settles its own endpoint's breaker.
+func (c *MLClient) attempt(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*models.MLPredictionResponse, error) {
+	start := time.Now()
+
+	replica := c.hedgeReplica(endpoint)
+	if replica == nil {
+		result, err := c.settledCall(ctx, endpoint, imagePath)
+		c.observe(endpoint, start, result, err)
+		return result, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered for both calls, so the loser never blocks after we return.
+	answers := make(chan hedgeAnswer, 2)
+	race := func(target *mlEndpoint) {
+		result, err := c.settledCall(ctx, target, imagePath)
+		answers <- hedgeAnswer{endpoint: target, result: result, err: err}
+	}
+	go race(endpoint)
+
+	timer := time.NewTimer(c.hedgeDelay(endpoint))
+	defer timer.Stop()
+
+	select {
+	case answer := <-answers:
+		c.observe(endpoint, start, answer.result, answer.err)
+		return answer.result, answer.err
+	case <-ctx.Done():
+		answer := <-answers
+		return answer.result, answer.err
+	case <-timer.C:
+	}
+
+	// A hedge is a second ML request, so it needs a limiter slot of its own
+	// when the caller is limited; without a free slot it is not sent.
+	limiter := mlLimiterFrom(ctx)
+	if limiter != nil && !limiter.TryAcquire() {
+		answer := <-answers
+		c.observe(endpoint, start, answer.result, answer.err)
+		return answer.result, answer.err
+	}
+	if replica.breaker.Allow() != nil {
+		if limiter != nil {
+			limiter.Release()
+		}
+		answer := <-answers
+		c.observe(endpoint, start, answer.result, answer.err)
+		return answer.result, answer.err
+	}
+	c.hedged.Add(1)
+	go func() {
+		if limiter != nil {
+			defer limiter.Release()
+		}
+		race(replica)
+	}()
+
+	winner := <-answers
+	if isServiceFailure(winner.result, winner.err) && ctx.Err() == nil {
+		// One call failing does not decide the attempt while the other
+		// may still succeed.
+		other := <-answers
+		if !isServiceFailure(other.result, other.err) || other.endpoint == endpoint {
+			winner = other
+		}
+	}
+
+	if winner.endpoint != endpoint {
+		c.replicaWon.Add(1)
+	}
+	c.observe(endpoint, start, winner.result, winner.err)
+	return winner.result, winner.err
+}
+
+// settledCall makes one call and records its outcome on the endpoint's
+// circuit breaker.
+func (c *MLClient) settledCall(ctx context.Context, endpoint *mlEndpoint, imagePath string) (*models.MLPredictionResponse, error) {
+	result, err := c.call(ctx, endpoint, imagePath)
+
+	switch {
+	case ctx.Err() != nil:
+		// The caller gave up or the other hedged call won; that says
+		// nothing about the service.
+		endpoint.breaker.Release()
+	case isServiceFailure(result, err):
+		endpoint.breaker.Failure()
+	default:
+		endpoint.breaker.Success()
+	}
+
+	return result, err
+}
+
+// observe records how long an answered attempt took, as the caller saw it.
+func (c *MLClient) observe(endpoint *mlEndpoint, start time.Time, result *models.MLPredictionResponse, err error) {
+	if c.HedgingEnabled() && !isServiceFailure(result, err) {
+		endpoint.latency.add(time.Since(start))
+	}
+}
+
+// hedgeReplica picks the endpoint to hedge endpoint's requests to: the next
+// endpoint in rotation serving the same model version whose breaker is not
+// open. Hedging never crosses model versions, so A/B results are not mixed.
+// It returns nil when hedging is off or there is no replica.
+func (c *MLClient) hedgeReplica(endpoint *mlEndpoint) *mlEndpoint {
+	// Cassettes answer instantly on replay and must record one call per
+	// attempt, so they are never hedged.
+	if !c.HedgingEnabled() || c.cassette != nil {
+		return nil
+	}
+
+	endpoints := c.router.endpoints
+	start := 0
+	for i, candidate := range endpoints {
+		if candidate == endpoint {
+			start = i
+			break
+		}
+	}
+
+	for offset := 1; offset < len(endpoints); offset++ {
+		candidate := endpoints[(start+offset)%len(endpoints)]
+		if candidate.Weight == 0 || candidate.ModelVersion != endpoint.ModelVersion {
+			continue
+		}
+		if state, _ := candidate.breaker.State(); state == CircuitOpen {
+			continue
+		}
+		return candidate
+	}
+
+	return nil
+}
+
+func (c *MLClient) hedgeDelay(endpoint *mlEndpoint) time.Duration {
+	policy := c.hedgePolicy
+
+	delay, ok := endpoint.latency.percentile(policy.Percentile)
+	if !ok {
+		delay = policy.MaxDelay
+	}
+	if delay < policy.MinDelay {
+		delay = policy.MinDelay
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type mlLimiterKey struct{}
+
+// WithMLLimiter marks ctx as holding a slot of limiter for the ML call made
+// with it, so that MLClient takes another slot before hedging the call.
+func WithMLLimiter(ctx context.Context, limiter *MLLimiter) context.Context {
+	return context.WithValue(ctx, mlLimiterKey{}, limiter)
+}
+
+func mlLimiterFrom(ctx context.Context) *MLLimiter {
+	limiter, _ := ctx.Value(mlLimiterKey{}).(*MLLimiter)
+	return limiter
+}
+
+var (
+	// ErrMLOverloaded is returned when every slot is taken and the wait
+	// queue is full; the caller should back off (429).
+	ErrMLOverloaded = errors.New("too many ML requests in flight")
+	// ErrMLBusy is returned when a queued call did not get a slot within the
+	// maximum wait (503).
+	ErrMLBusy = errors.New("timed out waiting for an ML request slot")
+)
+
+// MLLimiterStats is a snapshot of an MLLimiter for the stats endpoint.
+type MLLimiterStats struct {
+	MaxInFlight       int   `json:"max_in_flight"`
+	MaxQueued         int   `json:"max_queued"`
+	InFlight          int   `json:"in_flight"`
+	Queued            int   `json:"queued"`
+	Admitted          int64 `json:"admitted"`
+	RejectedQueueFull int64 `json:"rejected_queue_full"`
+	RejectedTimeout   int64 `json:"rejected_timeout"`
+}
+
+// MLLimiter bounds the synchronous calls to the ML service. At most
+// maxInFlight calls run at once; up to maxQueued more wait for a slot for at
+// most maxWait. Anything beyond that is shed immediately, so a burst is
+// turned away at the API instead of piling up on the model server.
+type MLLimiter struct {
+	slots     chan struct{}
+	maxQueued int
+	maxWait   time.Duration
+
+	mu                sync.Mutex
+	queued            int
+	admitted          int64
+	rejectedQueueFull int64
+	rejectedTimeout   int64
+}
+
+func NewMLLimiter(maxInFlight int, maxQueued int, maxWait time.Duration) *MLLimiter {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+
+	return &MLLimiter{
+		slots:     make(chan struct{}, maxInFlight),
+		maxQueued: maxQueued,
+		maxWait:   maxWait,
+	}
+}
+
+// Acquire takes a slot, waiting in the queue if needed. It returns
+// ErrMLOverloaded or ErrMLBusy when the call is shed, and the context error
+// if ctx ends while waiting. Every successful Acquire must be followed by
+// Release.
+func (l *MLLimiter) Acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		l.mu.Lock()
+		l.admitted++
+		l.mu.Unlock()
+		return nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.queued >= l.maxQueued {
+		l.rejectedQueueFull++
+		l.mu.Unlock()
+		return ErrMLOverloaded
+	}
+	l.queued++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.maxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case l.slots <- struct{}{}:
+	case <-timer.C:
+		err = ErrMLBusy
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.queued--
+	switch {
+	case err == nil:
+		l.admitted++
+	case errors.Is(err, ErrMLBusy):
+		l.rejectedTimeout++
+	}
+	return err
+}
+
+// TryAcquire takes a slot only if one is free right away. It is used for
+// hedged requests, which are dropped rather than queued.
+func (l *MLLimiter) TryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees the slot taken by Acquire or TryAcquire.
+func (l *MLLimiter) Release() {
+	<-l.slots
+}
+
+// RetryAfter suggests how long a shed client should wait before retrying:
+// the maximum queue wait, rounded up to whole seconds.
+func (l *MLLimiter) RetryAfter() time.Duration {
+	seconds := (l.maxWait + time.Second - 1) / time.Second
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds * time.Second
+}
+
+func (l *MLLimiter) Stats() MLLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return MLLimiterStats{
+		MaxInFlight:       cap(l.slots),
+		MaxQueued:         l.maxQueued,
+		InFlight:          len(l.slots),
+		Queued:            l.queued,
+		Admitted:          l.admitted,
+		RejectedQueueFull: l.rejectedQueueFull,
+		RejectedTimeout:   l.rejectedTimeout,
+	}
+}
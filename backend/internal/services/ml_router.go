@@ -0,0 +1,80 @@
+package services
+
+import (
+	"car-status-backend/internal/config"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// mlEndpoint is a configured ML deployment together with its own circuit
+// breaker, so an outage of one variant does not stop traffic to the others.
+// Endpoints with the same model version share a latency window for hedging.
+type mlEndpoint struct {
+	config.MLEndpoint
+	breaker *CircuitBreaker
+	latency *latencyWindow
+
+	// reported is the model version of the endpoint's last valid answer.
+	reported atomic.Value
+}
+
+func (e *mlEndpoint) reportedVersion() string {
+	version, _ := e.reported.Load().(string)
+	return version
+}
+
+// mlRouter splits predictions between endpoints by weight. The choice is a
+// hash of the image ID, so every attempt and every re-prediction of an image
+// goes to the same variant and A/B results are not mixed per image.
+type mlRouter struct {
+	endpoints   []*mlEndpoint
+	totalWeight int
+}
+
+func newMLRouter(endpoints []config.MLEndpoint, breakerThreshold int, breakerOpenTimeout time.Duration) *mlRouter {
+	router := &mlRouter{}
+	windows := map[string]*latencyWindow{}
+	for _, endpoint := range endpoints {
+		if windows[endpoint.ModelVersion] == nil {
+			windows[endpoint.ModelVersion] = &latencyWindow{}
+		}
+		router.endpoints = append(router.endpoints, &mlEndpoint{
+			MLEndpoint: endpoint,
+			breaker:    NewCircuitBreaker(breakerThreshold, breakerOpenTimeout),
+			latency:    windows[endpoint.ModelVersion],
+		})
+		router.totalWeight += endpoint.Weight
+	}
+	return router
+}
+
+func (r *mlRouter) route(imageID uuid.UUID) *mlEndpoint {
+	if len(r.endpoints) == 1 || r.totalWeight <= 0 {
+		return r.endpoints[0]
+	}
+
+	hash := fnv.New32a()
+	hash.Write(imageID[:])
+	point := int(hash.Sum32() % uint32(r.totalWeight))
+
+	for _, endpoint := range r.endpoints {
+		if point < endpoint.Weight {
+			return endpoint
+		}
+		point -= endpoint.Weight
+	}
+
+	return r.endpoints[len(r.endpoints)-1]
+}
+
+func (r *mlRouter) find(name string) *mlEndpoint {
+	for _, endpoint := range r.endpoints {
+		if endpoint.Name == name {
+			return endpoint
+		}
+	}
+	return nil
+}
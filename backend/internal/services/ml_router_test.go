@@ -0,0 +1,84 @@
+package services
+
+import (
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/mlfake"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMLRouterSplitsByWeightAndSticksToImage(t *testing.T) {
+	router := newMLRouter([]config.MLEndpoint{
+		{Name: "control", Weight: 90},
+		{Name: "candidate", Weight: 10},
+		{Name: "disabled", Weight: 0},
+	}, 5, time.Minute)
+
+	const images = 20000
+	counts := map[string]int{}
+	for i := 0; i < images; i++ {
+		imageID := uuid.New()
+		endpoint := router.route(imageID)
+		counts[endpoint.Name]++
+
+		// Every retry and re-prediction of the image sees the same variant.
+		for j := 0; j < 3; j++ {
+			if again := router.route(imageID); again != endpoint {
+				t.Fatalf("image %s routed to %s, then to %s", imageID, endpoint.Name, again.Name)
+			}
+		}
+	}
+
+	if share := float64(counts["candidate"]) / images; math.Abs(share-0.1) > 0.02 {
+		t.Errorf("candidate got %.1f%% of images, want about 10%%", share*100)
+	}
+	if counts["disabled"] != 0 {
+		t.Errorf("endpoint with weight 0 got %d images", counts["disabled"])
+	}
+}
+
+func TestMLClientStampsVariantOfRoutedEndpoint(t *testing.T) {
+	control, controlServer := mlfake.Start(mlfake.Script{Default: mlfake.Response{ModelVersion: "1.0"}})
+	t.Cleanup(controlServer.Close)
+	candidate, candidateServer := mlfake.Start(mlfake.Script{Default: mlfake.Response{ModelVersion: "2.0"}})
+	t.Cleanup(candidateServer.Close)
+
+	client := NewMLClient(
+		[]config.MLEndpoint{
+			{Name: "control", URL: controlServer.URL, Weight: 50},
+			{Name: "candidate", URL: candidateServer.URL, Weight: 50, ModelVersion: "2.0"},
+		},
+		5*time.Second, "", MLTransportPath, 0, RetryPolicy{},
+		HedgePolicy{}, 5, time.Minute, nil,
+	)
+	t.Cleanup(func() { client.Close() })
+
+	sent := map[string]int{}
+	for i := 0; i < 20; i++ {
+		imageID := uuid.New()
+		variant := client.VariantFor(imageID)
+		result, err := client.PredictCarStatus(context.Background(), imageID, "/uploads/car.jpg")
+		if err != nil || !result.Success {
+			t.Fatalf("PredictCarStatus = %+v, %v; want success", result, err)
+		}
+		if result.Variant != variant {
+			t.Errorf("result from variant %q, want %q", result.Variant, variant)
+		}
+		wantVersion := map[string]string{"control": "1.0", "candidate": "2.0"}[variant]
+		if result.ModelVersion != wantVersion {
+			t.Errorf("%s answered with model version %q, want %q", variant, result.ModelVersion, wantVersion)
+		}
+		sent[variant]++
+	}
+
+	if got := len(control.Requests()); got != sent["control"] {
+		t.Errorf("control got %d requests, want %d", got, sent["control"])
+	}
+	if got := len(candidate.Requests()); got != sent["candidate"] {
+		t.Errorf("candidate got %d requests, want %d", got, sent["candidate"])
+	}
+}
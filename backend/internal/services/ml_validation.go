@@ -0,0 +1,99 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"fmt"
+)
+
+// Failure reasons stored in predictions.failure_reason for ML responses that
+// were rejected by validateMLResponse.
+const (
+	FailureMalformedResponse   = "malformed_response"
+	FailureInvalidLabel        = "invalid_label"
+	FailureInvalidConfidence   = "invalid_confidence"
+	FailureMissingModelVersion = "missing_model_version"
+	FailureInvalidTiming       = "invalid_processing_time"
+)
+
+var (
+	cleanlinessLabels = map[string]bool{"clean": true, "dirty": true}
+	integrityLabels   = map[string]bool{"intact": true, "damaged": true}
+)
+
+// MLValidationError reports an ML response that was delivered successfully
+// but does not satisfy the prediction schema, such as an "unknown" label or
+// a confidence outside [0, 1]. Reason is one of the Failure* constants.
+type MLValidationError struct {
+	Reason  string
+	Field   string
+	Message string
+}
+
+func (e *MLValidationError) Error() string {
+	return fmt.Sprintf("invalid ML response: %s: %s", e.Field, e.Message)
+}
+
+// validateMLResponse checks a successful ML response against the constraints
+// of the predictions table before anything is persisted.
+func validateMLResponse(result *models.MLPredictionResponse) *MLValidationError {
+	if !cleanlinessLabels[result.Cleanliness.Status] {
+		return &MLValidationError{
+			Reason:  FailureInvalidLabel,
+			Field:   "cleanliness.status",
+			Message: fmt.Sprintf("unexpected label %q", result.Cleanliness.Status),
+		}
+	}
+	if !integrityLabels[result.Integrity.Status] {
+		return &MLValidationError{
+			Reason:  FailureInvalidLabel,
+			Field:   "integrity.status",
+			Message: fmt.Sprintf("unexpected label %q", result.Integrity.Status),
+		}
+	}
+
+	if err := validateConfidence("cleanliness.confidence", result.Cleanliness.Confidence); err != nil {
+		return err
+	}
+	if err := validateConfidence("integrity.confidence", result.Integrity.Confidence); err != nil {
+		return err
+	}
+
+	if result.ModelVersion == "" {
+		return &MLValidationError{
+			Reason:  FailureMissingModelVersion,
+			Field:   "model_version",
+			Message: "model version is missing",
+		}
+	}
+
+	if result.ProcessingTime < 0 {
+		return &MLValidationError{
+			Reason:  FailureInvalidTiming,
+			Field:   "processing_time_ms",
+			Message: fmt.Sprintf("negative processing time %d", result.ProcessingTime),
+		}
+	}
+
+	return nil
+}
+
+func validateConfidence(field string, confidence float64) *MLValidationError {
+	if confidence >= 0 && confidence <= 1 {
+		return nil
+	}
+
+	return &MLValidationError{
+		Reason:  FailureInvalidConfidence,
+		Field:   field,
+		Message: fmt.Sprintf("confidence %v is outside [0, 1]", confidence),
+	}
+}
+
+// rejectMLResponse turns result into a failed response carrying the
+// validation error, so it is stored as a failed prediction.
+func rejectMLResponse(result *models.MLPredictionResponse, err *MLValidationError) *models.MLPredictionResponse {
+	result.Success = false
+	result.Error = err.Error()
+	result.FailureReason = err.Reason
+	return result
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	outboxPublish    = "publish"
+	outboxDeadLetter = "dead_letter"
+
+	outboxBatchSize = 100
+	outboxRetention = time.Hour
+	// outboxClaimTimeout is how long claimed entries stay hidden from other
+	// relays while they are being published.
+	outboxClaimTimeout = time.Minute
+)
+
+type outboxEntry struct {
+	ID          int64  `db:"id"`
+	Kind        string `db:"kind"`
+	Payload     []byte `db:"payload"`
+	RemainingMs int64  `db:"remaining_ms"`
+	Reason      string `db:"reason"`
+	Attempts    int    `db:"attempts"`
+}
+
+// addToOutbox records a broker message in the job_outbox table. It is meant
+// to be called inside the transaction that changes the job, so the job row
+// and the message are committed or rolled back together.
+func addToOutbox(db queryer, kind string, request models.PredictionJobRequest, delay time.Duration, reason string) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+
+	query := `
+		INSERT INTO job_outbox (kind, payload, delay_ms, reason)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+	`
+
+	_, err = db.Exec(query, kind, payload, delay.Milliseconds(), reason)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// holdInOutbox records a publish message that the relay holds back until
+// the job is due after delay. Unlike a delayed message, the job waits in the
+// database rather than in the broker, so a rescheduled job can never block
+// the broker's retry queue for the jobs behind it.
+func holdInOutbox(db queryer, request models.PredictionJobRequest, delay time.Duration) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+
+	query := `
+		INSERT INTO job_outbox (kind, payload, available_at)
+		VALUES ($1, $2, NOW() + $3 * INTERVAL '1 millisecond')
+	`
+
+	_, err = db.Exec(query, outboxPublish, payload, delay.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// OutboxRelay publishes job_outbox entries to the broker with at-least-once
+// semantics: an entry is marked published only after the broker confirmed
+// it, so a crash in between publishes it again, which is harmless because
+// workers claim jobs by ID. Entries are claimed with FOR UPDATE SKIP LOCKED,
+// so every backend replica can run a relay.
+type OutboxRelay struct {
+	db       *database.DB
+	broker   jobBroker
+	interval time.Duration
+	wake     chan struct{}
+}
+
+func NewOutboxRelay(db *database.DB, broker jobBroker, interval time.Duration) *OutboxRelay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &OutboxRelay{
+		db:       db,
+		broker:   broker,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the relay run immediately instead of at its next interval.
+func (r *OutboxRelay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays entries until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	lastCleanup := time.Now()
+
+	for {
+		relayed, err := r.relayBatch(ctx)
+		if err != nil {
+			log.Printf("Outbox relay: %v", err)
+		}
+
+		if time.Since(lastCleanup) > 10*time.Minute {
+			r.cleanup()
+			lastCleanup = time.Now()
+		}
+
+		if relayed == outboxBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// Pending returns the number of entries that have not been published yet.
+func (r *OutboxRelay) Pending() (int, error) {
+	var pending int
+	err := r.db.Get(&pending, `SELECT COUNT(*) FROM job_outbox WHERE published_at IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count outbox entries: %w", err)
+	}
+
+	return pending, nil
+}
+
+// relayBatch claims up to outboxBatchSize due entries, commits the claim and
+// only then publishes them, so no transaction or row lock is held while the
+// broker is called. A claim hides the entries from other relays for
+// outboxClaimTimeout; entries whose relay died before marking them are
+// published again after that, which at-least-once delivery allows.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	var entries []outboxEntry
+	query := `
+		UPDATE job_outbox
+		SET available_at = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id
+			FROM job_outbox
+			WHERE published_at IS NULL AND available_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, COALESCE(reason, '') AS reason, attempts,
+		          GREATEST(delay_ms - EXTRACT(EPOCH FROM (NOW() - created_at)) * 1000, 0)::BIGINT AS remaining_ms
+	`
+
+	if err := r.db.Select(&entries, query, outboxBatchSize, outboxClaimTimeout.Milliseconds()); err != nil {
+		return 0, fmt.Errorf("failed to claim outbox entries: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	for _, entry := range entries {
+		if err := r.publish(ctx, entry); err != nil {
+			backoff := time.Second << min(entry.Attempts, 6)
+			_, updateErr := r.db.Exec(`
+				UPDATE job_outbox
+				SET attempts = attempts + 1, last_error = $2,
+				    available_at = NOW() + $3 * INTERVAL '1 millisecond'
+				WHERE id = $1
+			`, entry.ID, err.Error(), backoff.Milliseconds())
+			if updateErr != nil {
+				return len(entries), fmt.Errorf("failed to record outbox failure: %w", updateErr)
+			}
+			continue
+		}
+
+		if _, err := r.db.Exec(`UPDATE job_outbox SET published_at = NOW() WHERE id = $1`, entry.ID); err != nil {
+			return len(entries), fmt.Errorf("failed to mark outbox entry published: %w", err)
+		}
+	}
+
+	return len(entries), nil
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, entry outboxEntry) error {
+	var request models.PredictionJobRequest
+	if err := json.Unmarshal(entry.Payload, &request); err != nil {
+		return fmt.Errorf("malformed outbox payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if entry.Kind == outboxDeadLetter {
+		return r.broker.DeadLetter(ctx, request, entry.Reason)
+	}
+
+	return r.broker.Publish(ctx, request, time.Duration(entry.RemainingMs)*time.Millisecond)
+}
+
+func (r *OutboxRelay) cleanup() {
+	query := `DELETE FROM job_outbox WHERE published_at < NOW() - $1 * INTERVAL '1 millisecond'`
+
+	if _, err := r.db.Exec(query, outboxRetention.Milliseconds()); err != nil {
+		log.Printf("Outbox relay: failed to delete published entries: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/models"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type brokerMessage struct {
+	request models.PredictionJobRequest
+	delay   time.Duration
+	reason  string
+}
+
+// fakeBroker records what the relay publishes. The relay drains the whole
+// job_outbox table, so tests only look at the messages of their own jobs.
+type fakeBroker struct {
+	mu          sync.Mutex
+	published   []brokerMessage
+	deadLetters []brokerMessage
+	// err fails every call while it is set.
+	err error
+	// onPublish runs before a publish is recorded.
+	onPublish func()
+}
+
+func (f *fakeBroker) Publish(ctx context.Context, request models.PredictionJobRequest, delay time.Duration) error {
+	if f.onPublish != nil {
+		f.onPublish()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.published = append(f.published, brokerMessage{request: request, delay: delay})
+	return nil
+}
+
+func (f *fakeBroker) DeadLetter(ctx context.Context, request models.PredictionJobRequest, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.deadLetters = append(f.deadLetters, brokerMessage{request: request, reason: reason})
+	return nil
+}
+
+func (f *fakeBroker) Consume(ctx context.Context, concurrency int, handle func(workerID int, request models.PredictionJobRequest) error) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (f *fakeBroker) Close() error {
+	return nil
+}
+
+// messagesFor returns the messages published for jobID.
+func (f *fakeBroker) messagesFor(jobID uuid.UUID) []brokerMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var messages []brokerMessage
+	for _, message := range f.published {
+		if message.request.JobID == jobID {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+type outboxRow struct {
+	Attempts    int     `db:"attempts"`
+	LastError   *string `db:"last_error"`
+	AvailableIn float64 `db:"available_in"`
+	Published   bool    `db:"published"`
+}
+
+// addOutboxEntry writes a publish entry for a new job and returns the job ID.
+func addOutboxEntry(t *testing.T, db *database.DB, delay time.Duration) uuid.UUID {
+	t.Helper()
+
+	request := models.PredictionJobRequest{JobID: uuid.New(), ImageID: uuid.New(), CreatedAt: time.Now()}
+	if err := addToOutbox(db, outboxPublish, request, delay, ""); err != nil {
+		t.Fatalf("addToOutbox: %v", err)
+	}
+	return request.JobID
+}
+
+func getOutboxRow(t *testing.T, db *database.DB, jobID uuid.UUID) outboxRow {
+	t.Helper()
+
+	var row outboxRow
+	err := db.Get(&row, `
+		SELECT attempts, last_error, published_at IS NOT NULL AS published,
+		       EXTRACT(EPOCH FROM (available_at - NOW()))::FLOAT8 AS available_in
+		FROM job_outbox
+		WHERE payload->>'job_id' = $1
+	`, jobID.String())
+	if err != nil {
+		t.Fatalf("get outbox entry: %v", err)
+	}
+	return row
+}
+
+// expireClaim makes an entry due again, as if its claim timed out.
+func expireClaim(t *testing.T, db *database.DB, jobID uuid.UUID) {
+	t.Helper()
+
+	_, err := db.Exec(`UPDATE job_outbox SET available_at = NOW() WHERE payload->>'job_id' = $1`, jobID.String())
+	if err != nil {
+		t.Fatalf("expire outbox claim: %v", err)
+	}
+}
+
+func TestOutboxRelayPublishesEntriesOnce(t *testing.T) {
+	db := testDB(t)
+	broker := &fakeBroker{}
+	relay := NewOutboxRelay(db, broker, time.Second)
+
+	jobID := addOutboxEntry(t, db, time.Minute)
+	dead := models.PredictionJobRequest{JobID: uuid.New(), ImageID: uuid.New()}
+	if err := addToOutbox(db, outboxDeadLetter, dead, 0, "image not found"); err != nil {
+		t.Fatalf("addToOutbox: %v", err)
+	}
+
+	if _, err := relay.relayBatch(context.Background()); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+
+	messages := broker.messagesFor(jobID)
+	if len(messages) != 1 {
+		t.Fatalf("job was published %d times, want once", len(messages))
+	}
+	// The delay counts from when the entry was written.
+	if messages[0].delay <= 50*time.Second || messages[0].delay > time.Minute {
+		t.Errorf("published with delay %v, want just under a minute", messages[0].delay)
+	}
+	var deadLettered bool
+	for _, message := range broker.deadLetters {
+		if message.request.JobID == dead.JobID {
+			deadLettered = message.reason == "image not found"
+		}
+	}
+	if !deadLettered {
+		t.Error("dead-letter entry was not relayed with its reason")
+	}
+	if row := getOutboxRow(t, db, jobID); !row.Published {
+		t.Error("relayed entry is not marked published")
+	}
+
+	if _, err := relay.relayBatch(context.Background()); err != nil {
+		t.Fatalf("second relayBatch: %v", err)
+	}
+	if got := len(broker.messagesFor(jobID)); got != 1 {
+		t.Errorf("job was published %d times after a second pass, want once", got)
+	}
+}
+
+func TestOutboxRelayClaimHidesEntriesUntilItTimesOut(t *testing.T) {
+	db := testDB(t)
+	jobID := addOutboxEntry(t, db, 0)
+
+	// While the first relay publishes, a second relay must not see the
+	// entries it claimed.
+	other := &fakeBroker{}
+	otherRelay := NewOutboxRelay(db, other, time.Second)
+	broker := &fakeBroker{}
+	var once sync.Once
+	broker.onPublish = func() {
+		once.Do(func() {
+			if _, err := otherRelay.relayBatch(context.Background()); err != nil {
+				t.Errorf("concurrent relayBatch: %v", err)
+			}
+		})
+	}
+
+	if _, err := NewOutboxRelay(db, broker, time.Second).relayBatch(context.Background()); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	if got := len(other.messagesFor(jobID)); got != 0 {
+		t.Errorf("second relay published a claimed entry %d times", got)
+	}
+	if got := len(broker.messagesFor(jobID)); got != 1 {
+		t.Fatalf("first relay published the entry %d times, want once", got)
+	}
+
+	// A relay that dies after claiming leaves the entry unpublished but
+	// hidden for the claim timeout.
+	crashed := addOutboxEntry(t, db, 0)
+	_, err := db.Exec(`
+		UPDATE job_outbox SET available_at = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE payload->>'job_id' = $1
+	`, crashed.String(), outboxClaimTimeout.Milliseconds())
+	if err != nil {
+		t.Fatalf("claim entry: %v", err)
+	}
+
+	relay := NewOutboxRelay(db, broker, time.Second)
+	if _, err := relay.relayBatch(context.Background()); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	if got := len(broker.messagesFor(crashed)); got != 0 {
+		t.Fatalf("entry claimed by a dead relay was published %d times before its claim expired", got)
+	}
+
+	expireClaim(t, db, crashed)
+	if _, err := relay.relayBatch(context.Background()); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	if got := len(broker.messagesFor(crashed)); got != 1 {
+		t.Errorf("entry was published %d times after its claim expired, want once", got)
+	}
+}
+
+func TestOutboxRelayBacksOffAfterFailedPublish(t *testing.T) {
+	db := testDB(t)
+	broker := &fakeBroker{err: errors.New("broker unavailable")}
+	relay := NewOutboxRelay(db, broker, time.Second)
+	jobID := addOutboxEntry(t, db, 0)
+
+	for attempt, backoff := range []float64{1, 2} {
+		if attempt > 0 {
+			expireClaim(t, db, jobID)
+		}
+		if _, err := relay.relayBatch(context.Background()); err != nil {
+			t.Fatalf("relayBatch: %v", err)
+		}
+
+		row := getOutboxRow(t, db, jobID)
+		if row.Published || row.Attempts != attempt+1 {
+			t.Fatalf("after failure %d: published %v with %d attempts, want unpublished with %d", attempt+1, row.Published, row.Attempts, attempt+1)
+		}
+		if row.LastError == nil || *row.LastError != "broker unavailable" {
+			t.Errorf("last_error = %v, want the broker error", row.LastError)
+		}
+		if row.AvailableIn < backoff-0.5 || row.AvailableIn > backoff+0.5 {
+			t.Errorf("after failure %d the entry is due in %.1fs, want %.0fs", attempt+1, row.AvailableIn, backoff)
+		}
+	}
+
+	// The entry is not retried before its backoff has passed.
+	broker.mu.Lock()
+	broker.err = nil
+	broker.mu.Unlock()
+	if _, err := relay.relayBatch(context.Background()); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	if got := len(broker.messagesFor(jobID)); got != 0 {
+		t.Fatalf("entry was retried %d times during its backoff", got)
+	}
+
+	expireClaim(t, db, jobID)
+	if _, err := relay.relayBatch(context.Background()); err != nil {
+		t.Fatalf("relayBatch: %v", err)
+	}
+	if got := len(broker.messagesFor(jobID)); got != 1 || !getOutboxRow(t, db, jobID).Published {
+		t.Errorf("entry was published %d times after the broker recovered, want once and marked", got)
+	}
+}
@@ -3,11 +3,15 @@ package services
 import (
 	"car-status-backend/internal/database"
 	"car-status-backend/internal/models"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type PredictionService struct {
@@ -20,12 +24,13 @@ func NewPredictionService(db *database.DB) *PredictionService {
 	}
 }
 
-func (s *PredictionService) CreatePrediction(imageID uuid.UUID, mlResult *models.MLPredictionResponse) (*models.Prediction, error) {
+func (s *PredictionService) CreatePrediction(ctx context.Context, imageID uuid.UUID, mlResult *models.MLPredictionResponse) (*models.Prediction, error) {
 	prediction := &models.Prediction{
 		ID:                    uuid.New(),
 		ImageID:               imageID,
 		ProcessingTimeMs:      mlResult.ProcessingTime,
 		MLModelVersion:        mlResult.ModelVersion,
+		MLVariant:             mlResult.Variant,
 		CreatedAt:            time.Now(),
 	}
 
@@ -38,8 +43,11 @@ func (s *PredictionService) CreatePrediction(imageID uuid.UUID, mlResult *models
 		now := time.Now()
 		prediction.CompletedAt = &now
 	} else {
+		// Labels stay empty and are stored as NULL: the CHECK constraints
+		// only admit real labels.
 		prediction.Status = "failed"
 		prediction.ErrorMessage = mlResult.Error
+		prediction.FailureReason = mlResult.FailureReason
 	}
 
 	additionalData := map[string]interface{}{
@@ -52,13 +60,13 @@ func (s *PredictionService) CreatePrediction(imageID uuid.UUID, mlResult *models
 		INSERT INTO predictions (
 			id, image_id, cleanliness_status, cleanliness_confidence,
 			integrity_status, integrity_confidence, processing_time_ms,
-			ml_model_version, additional_data, status, error_message,
-			created_at, completed_at
+			ml_model_version, ml_variant, additional_data, status, error_message,
+			failure_reason, created_at, completed_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 
-	_, err := s.db.Exec(query,
+	_, err := s.db.ExecContext(ctx, query,
 		prediction.ID,
 		prediction.ImageID,
 		prediction.CleanlinessStatus,
@@ -67,36 +75,34 @@ func (s *PredictionService) CreatePrediction(imageID uuid.UUID, mlResult *models
 		prediction.IntegrityConfidence,
 		prediction.ProcessingTimeMs,
 		prediction.MLModelVersion,
+		prediction.MLVariant,
 		prediction.AdditionalData,
 		prediction.Status,
 		prediction.ErrorMessage,
+		prediction.FailureReason,
 		prediction.CreatedAt,
 		prediction.CompletedAt,
 	)
 
 	if err != nil {
-		fmt.Printf("DEBUG: Error saving prediction: %v\n", err)
-		fmt.Printf("DEBUG: CleanlinessStatus: %v\n", prediction.CleanlinessStatus)
-		fmt.Printf("DEBUG: IntegrityStatus: %v\n", prediction.IntegrityStatus)
-		fmt.Printf("DEBUG: Status: %v\n", prediction.Status)
 		return nil, fmt.Errorf("failed to save prediction: %w", err)
 	}
 
 	return prediction, nil
 }
 
-func (s *PredictionService) GetPredictionByID(id uuid.UUID) (*models.Prediction, error) {
+func (s *PredictionService) GetPredictionByID(ctx context.Context, id uuid.UUID) (*models.Prediction, error) {
 	var prediction models.Prediction
 	query := `
-		SELECT id, image_id, cleanliness_status, cleanliness_confidence,
-		       integrity_status, integrity_confidence, processing_time_ms,
-		       ml_model_version, additional_data, status, error_message,
-		       created_at, completed_at
+		SELECT id, image_id, COALESCE(cleanliness_status, '') AS cleanliness_status, cleanliness_confidence,
+		       COALESCE(integrity_status, '') AS integrity_status, integrity_confidence, processing_time_ms,
+		       ml_model_version, ml_variant, additional_data, status, error_message,
+		       failure_reason, created_at, completed_at
 		FROM predictions
 		WHERE id = $1
 	`
 
-	err := s.db.Get(&prediction, query, id)
+	err := s.db.GetContext(ctx, &prediction, query, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get prediction: %w", err)
 	}
@@ -104,19 +110,19 @@ func (s *PredictionService) GetPredictionByID(id uuid.UUID) (*models.Prediction,
 	return &prediction, nil
 }
 
-func (s *PredictionService) GetPredictionsByImageID(imageID uuid.UUID) ([]models.Prediction, error) {
+func (s *PredictionService) GetPredictionsByImageID(ctx context.Context, imageID uuid.UUID) ([]models.Prediction, error) {
 	var predictions []models.Prediction
 	query := `
-		SELECT id, image_id, cleanliness_status, cleanliness_confidence,
-		       integrity_status, integrity_confidence, processing_time_ms,
-		       ml_model_version, additional_data, status, error_message,
-		       created_at, completed_at
+		SELECT id, image_id, COALESCE(cleanliness_status, '') AS cleanliness_status, cleanliness_confidence,
+		       COALESCE(integrity_status, '') AS integrity_status, integrity_confidence, processing_time_ms,
+		       ml_model_version, ml_variant, additional_data, status, error_message,
+		       failure_reason, created_at, completed_at
 		FROM predictions
 		WHERE image_id = $1
 		ORDER BY created_at DESC
 	`
 
-	err := s.db.Select(&predictions, query, imageID)
+	err := s.db.SelectContext(ctx, &predictions, query, imageID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get predictions: %w", err)
 	}
@@ -124,7 +130,31 @@ func (s *PredictionService) GetPredictionsByImageID(imageID uuid.UUID) ([]models
 	return predictions, nil
 }
 
-func (s *PredictionService) UpdatePredictionStatus(id uuid.UUID, status string, errorMessage string) error {
+func (s *PredictionService) GetPredictionsByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Prediction, error) {
+	idStrings := make([]string, len(ids))
+	for i, id := range ids {
+		idStrings[i] = id.String()
+	}
+
+	var predictions []models.Prediction
+	query := `
+		SELECT id, image_id, COALESCE(cleanliness_status, '') AS cleanliness_status, cleanliness_confidence,
+		       COALESCE(integrity_status, '') AS integrity_status, integrity_confidence, processing_time_ms,
+		       ml_model_version, ml_variant, additional_data, status, error_message,
+		       failure_reason, created_at, completed_at
+		FROM predictions
+		WHERE id = ANY($1::uuid[])
+	`
+
+	err := s.db.SelectContext(ctx, &predictions, query, pq.Array(idStrings))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get predictions: %w", err)
+	}
+
+	return predictions, nil
+}
+
+func (s *PredictionService) UpdatePredictionStatus(ctx context.Context, id uuid.UUID, status string, errorMessage string) error {
 	query := `
 		UPDATE predictions
 		SET status = $1, error_message = $2, completed_at = $3
@@ -137,7 +167,7 @@ func (s *PredictionService) UpdatePredictionStatus(id uuid.UUID, status string,
 		completedAt = &now
 	}
 
-	_, err := s.db.Exec(query, status, errorMessage, completedAt, id)
+	_, err := s.db.ExecContext(ctx, query, status, errorMessage, completedAt, id)
 	if err != nil {
 		return fmt.Errorf("failed to update prediction status: %w", err)
 	}
@@ -145,7 +175,7 @@ func (s *PredictionService) UpdatePredictionStatus(id uuid.UUID, status string,
 	return nil
 }
 
-func (s *PredictionService) GetPredictionStats() (map[string]interface{}, error) {
+func (s *PredictionService) GetPredictionStats(ctx context.Context) (map[string]interface{}, error) {
 	query := `
 		SELECT
 			COUNT(*) as total,
@@ -167,7 +197,7 @@ func (s *PredictionService) GetPredictionStats() (map[string]interface{}, error)
 		AvgProcessingTime  *float64 `db:"avg_processing_time"`
 	}
 
-	err := s.db.Get(&stats, query)
+	err := s.db.GetContext(ctx, &stats, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get prediction stats: %w", err)
 	}
@@ -184,5 +214,143 @@ func (s *PredictionService) GetPredictionStats() (map[string]interface{}, error)
 		result["avg_processing_time_ms"] = *stats.AvgProcessingTime
 	}
 
+	variants, err := s.getVariantStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result["variants"] = variants
+
 	return result, nil
+}
+
+// VariantStats summarises the last 24 hours of predictions made by one ML
+// endpoint and model version, for comparing A/B variants.
+type VariantStats struct {
+	Variant                  string   `json:"variant" db:"ml_variant"`
+	ModelVersion             string   `json:"model_version" db:"ml_model_version"`
+	Total                    int      `json:"total" db:"total"`
+	Completed                int      `json:"completed" db:"completed"`
+	Failed                   int      `json:"failed" db:"failed"`
+	Dirty                    int      `json:"dirty" db:"dirty"`
+	Damaged                  int      `json:"damaged" db:"damaged"`
+	AvgProcessingTimeMs      *float64 `json:"avg_processing_time_ms,omitempty" db:"avg_processing_time"`
+	AvgCleanlinessConfidence *float64 `json:"avg_cleanliness_confidence,omitempty" db:"avg_cleanliness_confidence"`
+	AvgIntegrityConfidence   *float64 `json:"avg_integrity_confidence,omitempty" db:"avg_integrity_confidence"`
+}
+
+func (s *PredictionService) getVariantStats(ctx context.Context) ([]VariantStats, error) {
+	query := `
+		SELECT
+			ml_variant,
+			COALESCE(ml_model_version, '') as ml_model_version,
+			COUNT(*) as total,
+			COUNT(CASE WHEN status = 'completed' THEN 1 END) as completed,
+			COUNT(CASE WHEN status = 'failed' THEN 1 END) as failed,
+			COUNT(CASE WHEN cleanliness_status = 'dirty' THEN 1 END) as dirty,
+			COUNT(CASE WHEN integrity_status = 'damaged' THEN 1 END) as damaged,
+			AVG(CASE WHEN processing_time_ms > 0 THEN processing_time_ms END) as avg_processing_time,
+			AVG(CASE WHEN status = 'completed' THEN cleanliness_confidence END) as avg_cleanliness_confidence,
+			AVG(CASE WHEN status = 'completed' THEN integrity_confidence END) as avg_integrity_confidence
+		FROM predictions
+		WHERE created_at > NOW() - INTERVAL '24 hours'
+		GROUP BY ml_variant, COALESCE(ml_model_version, '')
+		ORDER BY ml_variant, ml_model_version
+	`
+
+	variants := []VariantStats{}
+	err := s.db.SelectContext(ctx, &variants, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prediction variant stats: %w", err)
+	}
+
+	return variants, nil
+}
+
+// FindCachedPrediction returns the latest completed prediction for any image
+// with contentHash made by modelVersion, or nil if there is none. An unknown
+// (empty) model version never matches, so a model upgrade cannot be hidden
+// behind old predictions.
+func (s *PredictionService) FindCachedPrediction(ctx context.Context, contentHash string, modelVersion string) (*models.Prediction, error) {
+	if modelVersion == "" {
+		return nil, nil
+	}
+
+	var prediction models.Prediction
+	query := `
+		SELECT p.id, p.image_id, COALESCE(p.cleanliness_status, '') AS cleanliness_status, p.cleanliness_confidence,
+		       COALESCE(p.integrity_status, '') AS integrity_status, p.integrity_confidence, p.processing_time_ms,
+		       p.ml_model_version, p.ml_variant, p.additional_data, p.status, p.error_message,
+		       p.failure_reason, p.created_at, p.completed_at
+		FROM predictions p
+		JOIN car_images i ON i.id = p.image_id
+		WHERE i.content_hash = $1 AND p.ml_model_version = $2 AND p.status = 'completed'
+		ORDER BY p.created_at DESC
+		LIMIT 1
+	`
+
+	err := s.db.GetContext(ctx, &prediction, query, contentHash, modelVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached prediction: %w", err)
+	}
+
+	return &prediction, nil
+}
+
+// ReusePrediction returns cached as the prediction for imageID. A prediction
+// made for another image with the same content is copied to imageID, with
+// the source recorded in additional_data and no processing time, so cache
+// hits do not skew latency stats.
+func (s *PredictionService) ReusePrediction(ctx context.Context, cached *models.Prediction, imageID uuid.UUID) (*models.Prediction, error) {
+	if cached.ImageID == imageID {
+		return cached, nil
+	}
+
+	additionalData, _ := json.Marshal(map[string]interface{}{
+		"cached_from": cached.ID,
+	})
+
+	now := time.Now()
+	prediction := *cached
+	prediction.ID = uuid.New()
+	prediction.ImageID = imageID
+	prediction.ProcessingTimeMs = 0
+	prediction.AdditionalData = additionalData
+	prediction.CreatedAt = now
+	prediction.CompletedAt = &now
+
+	query := `
+		INSERT INTO predictions (
+			id, image_id, cleanliness_status, cleanliness_confidence,
+			integrity_status, integrity_confidence, processing_time_ms,
+			ml_model_version, ml_variant, additional_data, status, error_message,
+			failure_reason, created_at, completed_at
+		)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		prediction.ID,
+		prediction.ImageID,
+		prediction.CleanlinessStatus,
+		prediction.CleanlinessConfidence,
+		prediction.IntegrityStatus,
+		prediction.IntegrityConfidence,
+		prediction.ProcessingTimeMs,
+		prediction.MLModelVersion,
+		prediction.MLVariant,
+		prediction.AdditionalData,
+		prediction.Status,
+		prediction.ErrorMessage,
+		prediction.FailureReason,
+		prediction.CreatedAt,
+		prediction.CompletedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save cached prediction: %w", err)
+	}
+
+	return &prediction, nil
 }
\ No newline at end of file
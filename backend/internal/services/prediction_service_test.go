@@ -0,0 +1,123 @@
+package services
+
+import (
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/models"
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// storePrediction saves an ML result for a new image with contentHash.
+func storePrediction(t *testing.T, db *database.DB, service *PredictionService, contentHash string, result models.MLPredictionResponse) *models.Prediction {
+	t.Helper()
+
+	prediction, err := service.CreatePrediction(context.Background(), insertImage(t, db, contentHash), &result)
+	if err != nil {
+		t.Fatalf("CreatePrediction: %v", err)
+	}
+	return prediction
+}
+
+func mlResult(variant, modelVersion, cleanliness string, confidence float64) models.MLPredictionResponse {
+	result := models.MLPredictionResponse{
+		Success:        true,
+		Variant:        variant,
+		ModelVersion:   modelVersion,
+		ProcessingTime: 100,
+	}
+	result.Cleanliness.Status = cleanliness
+	result.Cleanliness.Confidence = confidence
+	result.Integrity.Status = "intact"
+	result.Integrity.Confidence = confidence
+	return result
+}
+
+func TestPredictionServiceReportsStatsPerVariant(t *testing.T) {
+	db := testDB(t)
+	service := NewPredictionService(db)
+
+	// Variant names unique to this run keep other rows out of the groups.
+	control := "control-" + uuid.NewString()
+	candidate := "candidate-" + uuid.NewString()
+
+	storePrediction(t, db, service, "", mlResult(control, "1.0", "clean", 0.9))
+	storePrediction(t, db, service, "", mlResult(control, "1.0", "dirty", 0.7))
+	storePrediction(t, db, service, "", mlResult(candidate, "2.0", "dirty", 0.6))
+	storePrediction(t, db, service, "", models.MLPredictionResponse{Variant: candidate, ModelVersion: "2.0", Error: "timeout"})
+
+	stats, err := service.GetPredictionStats(context.Background())
+	if err != nil {
+		t.Fatalf("GetPredictionStats: %v", err)
+	}
+	byVariant := map[string]VariantStats{}
+	for _, variant := range stats["variants"].([]VariantStats) {
+		byVariant[variant.Variant] = variant
+	}
+
+	got := byVariant[control]
+	if got.ModelVersion != "1.0" || got.Total != 2 || got.Completed != 2 || got.Dirty != 1 {
+		t.Errorf("control stats = %+v, want 2 completed, 1 dirty on 1.0", got)
+	}
+	if got.AvgCleanlinessConfidence == nil || *got.AvgCleanlinessConfidence < 0.79 || *got.AvgCleanlinessConfidence > 0.81 {
+		t.Errorf("control average cleanliness confidence = %v, want 0.8", got.AvgCleanlinessConfidence)
+	}
+
+	got = byVariant[candidate]
+	if got.ModelVersion != "2.0" || got.Total != 2 || got.Completed != 1 || got.Failed != 1 {
+		t.Errorf("candidate stats = %+v, want 1 completed and 1 failed on 2.0", got)
+	}
+	// Failed predictions carry no confidence to average in.
+	if got.AvgCleanlinessConfidence == nil || *got.AvgCleanlinessConfidence < 0.59 || *got.AvgCleanlinessConfidence > 0.61 {
+		t.Errorf("candidate average cleanliness confidence = %v, want 0.6", got.AvgCleanlinessConfidence)
+	}
+}
+
+func TestPredictionServiceFindsCachedPredictionByHashAndVersion(t *testing.T) {
+	db := testDB(t)
+	service := NewPredictionService(db)
+	ctx := context.Background()
+
+	hash := uuid.NewString()
+	storePrediction(t, db, service, hash, mlResult("default", "1.0", "clean", 0.6))
+	latest := storePrediction(t, db, service, hash, mlResult("default", "1.0", "dirty", 0.9))
+	storePrediction(t, db, service, hash, models.MLPredictionResponse{ModelVersion: "1.0", Error: "timeout"})
+	storePrediction(t, db, service, uuid.NewString(), mlResult("default", "1.0", "clean", 0.9))
+
+	cached, err := service.FindCachedPrediction(ctx, hash, "1.0")
+	if err != nil {
+		t.Fatalf("FindCachedPrediction: %v", err)
+	}
+	// The failed prediction is newer but never reused.
+	if cached == nil || cached.ID != latest.ID {
+		t.Fatalf("cached = %+v, want the latest completed prediction %s", cached, latest.ID)
+	}
+
+	for _, version := range []string{"2.0", ""} {
+		cached, err := service.FindCachedPrediction(ctx, hash, version)
+		if err != nil || cached != nil {
+			t.Errorf("FindCachedPrediction for model version %q = %+v, %v; want no hit", version, cached, err)
+		}
+	}
+
+	imageID := insertImage(t, db, hash)
+	reused, err := service.ReusePrediction(ctx, cached, imageID)
+	if err != nil {
+		t.Fatalf("ReusePrediction: %v", err)
+	}
+	if reused.ID == latest.ID || reused.ImageID != imageID {
+		t.Errorf("reused prediction %s is for image %s, want a new prediction for %s", reused.ID, reused.ImageID, imageID)
+	}
+	if reused.CleanlinessStatus != "dirty" || reused.MLModelVersion != "1.0" || reused.ProcessingTimeMs != 0 {
+		t.Errorf("reused prediction = %+v, want the cached labels without processing time", reused)
+	}
+	if stored, err := service.GetPredictionByID(ctx, reused.ID); err != nil || stored.ImageID != imageID {
+		t.Errorf("GetPredictionByID = %+v, %v; want the stored copy", stored, err)
+	}
+
+	// Re-predicting the same image keeps its own prediction.
+	if same, err := service.ReusePrediction(ctx, latest, latest.ImageID); err != nil || same.ID != latest.ID {
+		t.Errorf("ReusePrediction for its own image = %+v, %v; want it unchanged", same, err)
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrJobNotFound   = errors.New("job not found")
+	ErrJobNotPending = errors.New("job is no longer pending")
+	ErrJobFinished   = errors.New("job has already finished")
+	ErrJobCancelled  = errors.New("job has been cancelled")
+	// ErrJobLeaseLost is returned when a worker reports on a job it no longer
+	// holds, because the reaper took the lease back and the job may already
+	// be running elsewhere.
+	ErrJobLeaseLost = errors.New("job lease lost")
+)
+
+// Queue is the asynchronous prediction job queue. Handlers publish jobs and
+// read their status; workers claim jobs, keep their lease alive and report
+// the outcome with Ack or Nack.
+type Queue interface {
+	// Type returns the backend name ("db", "rabbitmq", "kafka" or "memory").
+	Type() string
+
+	// Publish creates a pending job for the image and hands it to the backend.
+	Publish(imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error)
+
+	// PublishTx is Publish inside the caller's transaction, so the job is
+	// committed or rolled back together with the rows it belongs to, such as
+	// its image or batch. MemoryQueue keeps jobs outside the database and
+	// publishes them right away.
+	PublishTx(tx *sqlx.Tx, imageID uuid.UUID, imagePath string, opts models.JobOptions) (*models.PredictionJob, error)
+
+	// Claim leases the next due job to workerID for the lease duration,
+	// preferring higher priorities and letting clients take turns. It
+	// returns nil without an error when no job is available.
+	Claim(ctx context.Context, workerID string, lease time.Duration) (*models.PredictionJob, error)
+
+	// RenewLease extends the lease of a claimed job. It fails once the lease
+	// has been lost to the reaper, and returns ErrJobCancelled once
+	// cancellation has been requested so the worker can stop early.
+	RenewLease(jobID uuid.UUID, workerID string, lease time.Duration) error
+
+	// Ack marks a job claimed by workerID completed with the prediction it
+	// produced. It returns ErrJobLeaseLost if workerID no longer holds the job.
+	Ack(jobID uuid.UUID, workerID string, predictionID uuid.UUID) error
+
+	// Nack reports a failed attempt of a job claimed by job.LockedBy.
+	// Retryable failures are rescheduled with backoff while the job has
+	// retries left; everything else is moved to dead_letter. The resulting
+	// job status is returned, or ErrJobLeaseLost if the lease was lost.
+	Nack(job *models.PredictionJob, reason string, retryable bool) (models.JobStatus, error)
+
+	// AckCancel marks a job claimed by workerID cancelled after the worker
+	// stopped in response to a cancellation request.
+	AckCancel(jobID uuid.UUID, workerID string) error
+
+	// Cancel cancels a pending job immediately and asks the worker holding a
+	// processing job to stop. Finished jobs return ErrJobFinished.
+	Cancel(jobID uuid.UUID) (*models.PredictionJob, error)
+
+	// Update changes the priority or schedule of a pending job. Jobs that are
+	// no longer pending return ErrJobNotPending.
+	Update(jobID uuid.UUID, update models.JobUpdate) (*models.PredictionJob, error)
+
+	// SetPrediction links a job to a prediction without changing its status.
+	SetPrediction(jobID, predictionID uuid.UUID) error
+
+	// ReapExpired returns jobs whose lease has expired to pending, or to
+	// dead_letter when they have no retries left, and reports both counts.
+	ReapExpired() (int, int, error)
+
+	Get(jobID uuid.UUID) (*models.PredictionJob, error)
+	ListByBatch(batchID uuid.UUID) ([]models.PredictionJob, error)
+	ListDeadLetter(limit, offset int) ([]models.PredictionJob, int, error)
+
+	// Requeue returns a dead-lettered job to pending with a fresh retry
+	// budget. Jobs that are not dead-lettered return ErrJobNotFound.
+	Requeue(jobID uuid.UUID) (*models.PredictionJob, error)
+
+	Stats() (map[string]interface{}, error)
+	Close() error
+}
+
+// NewQueue builds the queue backend selected by Queue.Type.
+func NewQueue(cfg config.Config, db *database.DB) (Queue, error) {
+	retryPolicy := RetryPolicy{
+		BaseDelay: cfg.Queue.RetryBaseDelay,
+		MaxDelay:  cfg.Queue.RetryMaxDelay,
+		Jitter:    cfg.Queue.RetryJitter,
+	}
+
+	switch cfg.Queue.Type {
+	case "db", "":
+		return NewDBQueue(cfg.Queue.MaxRetries, retryPolicy, cfg.Queue.QueueName, database.DSN(cfg), db), nil
+	case "memory":
+		return NewMemoryQueue(cfg.Queue.MaxRetries, retryPolicy), nil
+	case "rabbitmq":
+		broker, err := NewRabbitMQBroker(cfg.Queue.URL, cfg.Queue.QueueName)
+		if err != nil {
+			return nil, err
+		}
+		return NewBrokerQueue("rabbitmq", broker, NewDBQueue(cfg.Queue.MaxRetries, retryPolicy, "", "", db), cfg.Worker.PoolSize, cfg.Queue.OutboxInterval), nil
+	case "kafka":
+		partitions := cfg.Queue.Partitions
+		if partitions <= 0 {
+			partitions = cfg.Worker.PoolSize
+		}
+		broker, err := NewKafkaBroker(cfg.Queue.URL, cfg.Queue.QueueName, partitions)
+		if err != nil {
+			return nil, err
+		}
+		return NewBrokerQueue("kafka", broker, NewDBQueue(cfg.Queue.MaxRetries, retryPolicy, "", "", db), cfg.Worker.PoolSize, cfg.Queue.OutboxInterval), nil
+	default:
+		return nil, fmt.Errorf("unknown queue type %q", cfg.Queue.Type)
+	}
+}
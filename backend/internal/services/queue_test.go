@@ -0,0 +1,105 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// queueFixture adapts a queue backend to the shared tests below: newImage
+// returns an image jobs may point at, and process puts a job into
+// processing under the returned worker ID as if a worker had claimed it.
+type queueFixture struct {
+	queue    Queue
+	newImage func(t *testing.T) uuid.UUID
+	process  func(t *testing.T, job *models.PredictionJob) string
+}
+
+func (f queueFixture) publish(t *testing.T) *models.PredictionJob {
+	t.Helper()
+
+	job, err := f.queue.Publish(f.newImage(t), "", models.JobOptions{ClientID: "client"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return job
+}
+
+func testQueueCancel(t *testing.T, f queueFixture) {
+	if _, err := f.queue.Cancel(uuid.New()); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Cancel of an unknown job = %v, want ErrJobNotFound", err)
+	}
+
+	pending := f.publish(t)
+	job, err := f.queue.Cancel(pending.ID)
+	if err != nil {
+		t.Fatalf("Cancel of a pending job: %v", err)
+	}
+	if job.Status != string(models.JobStatusCancelled) || job.CompletedAt == nil {
+		t.Errorf("pending job is %s (completed at %v) after Cancel, want cancelled", job.Status, job.CompletedAt)
+	}
+	if _, err := f.queue.Cancel(pending.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("second Cancel = %v, want ErrJobFinished", err)
+	}
+
+	// A processing job keeps running until its worker notices the request.
+	processing := f.publish(t)
+	workerID := f.process(t, processing)
+	job, err = f.queue.Cancel(processing.ID)
+	if err != nil {
+		t.Fatalf("Cancel of a processing job: %v", err)
+	}
+	if job.Status != string(models.JobStatusProcessing) || !job.CancelRequested {
+		t.Errorf("processing job is %s with CancelRequested %v, want processing with a request", job.Status, job.CancelRequested)
+	}
+	if err := f.queue.RenewLease(processing.ID, workerID, time.Minute); !errors.Is(err, ErrJobCancelled) {
+		t.Errorf("RenewLease = %v, want ErrJobCancelled", err)
+	}
+	if err := f.queue.AckCancel(processing.ID, workerID); err != nil {
+		t.Fatalf("AckCancel: %v", err)
+	}
+	if stored, _ := f.queue.Get(processing.ID); stored.Status != string(models.JobStatusCancelled) {
+		t.Errorf("job is %s after AckCancel, want cancelled", stored.Status)
+	}
+}
+
+func testQueueUpdate(t *testing.T, f queueFixture) {
+	priority := 9
+	later := time.Now().Add(time.Hour)
+	update := models.JobUpdate{Priority: &priority, ScheduledAt: &later}
+
+	if _, err := f.queue.Update(uuid.New(), update); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Update of an unknown job = %v, want ErrJobNotFound", err)
+	}
+
+	pending := f.publish(t)
+	job, err := f.queue.Update(pending.ID, update)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if job.Priority != priority {
+		t.Errorf("Priority = %d, want %d", job.Priority, priority)
+	}
+	if diff := job.ScheduledAt.Sub(later); diff < -time.Second || diff > time.Second {
+		t.Errorf("ScheduledAt = %v, want %v", job.ScheduledAt, later)
+	}
+
+	// Only the priority changes when no schedule is given.
+	priority = 1
+	job, err = f.queue.Update(pending.ID, models.JobUpdate{Priority: &priority})
+	if err != nil {
+		t.Fatalf("Update of the priority: %v", err)
+	}
+	if job.Priority != 1 || job.ScheduledAt.Sub(later) < -time.Second {
+		t.Errorf("job has priority %d and schedule %v, want 1 and %v", job.Priority, job.ScheduledAt, later)
+	}
+
+	processing := f.publish(t)
+	f.process(t, processing)
+	if _, err := f.queue.Update(processing.ID, update); !errors.Is(err, ErrJobNotPending) {
+		t.Errorf("Update of a processing job = %v, want ErrJobNotPending", err)
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"car-status-backend/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQBroker publishes prediction job messages over AMQP 0-9-1 with
+// publisher confirms and consumes them with manual acks.
+//
+// Besides the work queue and "<name>.dead", one durable retry queue
+// "<name>.retry.<ms>" is declared per delay bucket. Each has a fixed
+// queue-level TTL and dead-letters expired messages back into the work
+// queue, which is how delayed retries are implemented without a broker
+// plugin. Since every message in a retry queue has the same TTL, messages
+// expire in the order they were queued and a long delay never holds up a
+// shorter one behind it. The dead queue only collects jobs that gave up, for
+// inspection. The work queue is a priority queue, so higher priority jobs are
+// delivered first; per-client fairness is only applied by the DB queue.
+type RabbitMQBroker struct {
+	url       string
+	queueName string
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func NewRabbitMQBroker(url, queueName string) (*RabbitMQBroker, error) {
+	b := &RabbitMQBroker{
+		url:       url,
+		queueName: queueName,
+	}
+
+	if err := b.connect(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *RabbitMQBroker) connect() error {
+	conn, err := amqp.Dial(b.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	if err := b.declareQueues(ch); err != nil {
+		conn.Close()
+		return err
+	}
+
+	b.conn = conn
+	b.channel = ch
+	return nil
+}
+
+// queueDeclarer is the part of *amqp.Channel that declares queues.
+type queueDeclarer interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+}
+
+func (b *RabbitMQBroker) declareQueues(ch queueDeclarer) error {
+	workArgs := amqp.Table{
+		"x-max-priority": models.JobPriorityHigh,
+	}
+	if _, err := ch.QueueDeclare(b.queueName, true, false, false, false, workArgs); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", b.queueName, err)
+	}
+
+	for _, bucket := range retryBuckets {
+		retryArgs := amqp.Table{
+			"x-message-ttl":             bucket.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": b.queueName,
+		}
+		if _, err := ch.QueueDeclare(b.retryQueueName(bucket), true, false, false, false, retryArgs); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", b.retryQueueName(bucket), err)
+		}
+	}
+
+	if _, err := ch.QueueDeclare(b.deadQueueName(), true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", b.deadQueueName(), err)
+	}
+
+	return nil
+}
+
+func (b *RabbitMQBroker) retryQueueName(bucket time.Duration) string {
+	return fmt.Sprintf("%s.retry.%d", b.queueName, bucket.Milliseconds())
+}
+
+func (b *RabbitMQBroker) deadQueueName() string {
+	return b.queueName + ".dead"
+}
+
+// Publish sends the job to the work queue, or through the retry queue of the
+// longest bucket within delay when delay is positive, and waits for the
+// broker to confirm it. Rounding down delivers the job up to one bucket
+// early; BrokerQueue then keeps it in the outbox until it is due.
+func (b *RabbitMQBroker) Publish(ctx context.Context, request models.PredictionJobRequest, delay time.Duration) error {
+	routingKey := b.queueName
+	if bucket := retryBucket(delay); bucket > 0 {
+		routingKey = b.retryQueueName(bucket)
+	}
+
+	return b.publish(ctx, routingKey, request, nil)
+}
+
+func (b *RabbitMQBroker) DeadLetter(ctx context.Context, request models.PredictionJobRequest, reason string) error {
+	return b.publish(ctx, b.deadQueueName(), request, amqp.Table{"x-error": reason})
+}
+
+func (b *RabbitMQBroker) publish(ctx context.Context, routingKey string, request models.PredictionJobRequest, headers amqp.Table) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.channel == nil || b.channel.IsClosed() {
+		if b.conn != nil {
+			b.conn.Close()
+		}
+		if err := b.connect(); err != nil {
+			return err
+		}
+	}
+
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Priority:     uint8(request.Priority),
+		Timestamp:    time.Now(),
+		Headers:      headers,
+		Body:         body,
+	}
+
+	confirm, err := b.channel.PublishWithDeferredConfirmWithContext(ctx, "", routingKey, false, false, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publisher confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("message was not confirmed by RabbitMQ")
+	}
+
+	return nil
+}
+
+// Consume delivers messages from the work queue to handle on concurrency
+// goroutines, with the channel prefetch set to the same number. A message is
+// acked when handle returns nil and requeued when it returns an error.
+// Consume blocks until ctx is cancelled (returning nil once in-flight
+// messages are finished) or the connection is lost (returning an error).
+func (b *RabbitMQBroker) Consume(ctx context.Context, concurrency int, handle func(workerID int, request models.PredictionJobRequest) error) error {
+	conn, err := amqp.Dial(b.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+
+	if err := b.declareQueues(ch); err != nil {
+		return err
+	}
+
+	if err := ch.Qos(concurrency, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
+
+	consumerTag := fmt.Sprintf("%s-%d", b.queueName, time.Now().UnixNano())
+	deliveries, err := ch.Consume(b.queueName, consumerTag, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start consuming %s: %w", b.queueName, err)
+	}
+
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+
+			for d := range deliveries {
+				var request models.PredictionJobRequest
+				if err := json.Unmarshal(d.Body, &request); err != nil {
+					// A malformed message will never succeed, so it is dropped.
+					log.Printf("RabbitMQ consumer %d: dropping malformed message: %v", workerID, err)
+					d.Ack(false)
+					continue
+				}
+
+				if err := handle(workerID, request); err != nil {
+					log.Printf("RabbitMQ consumer %d: requeueing message: %v", workerID, err)
+					d.Nack(false, true)
+					continue
+				}
+				d.Ack(false)
+			}
+		}(i + 1)
+	}
+
+	select {
+	case <-ctx.Done():
+		ch.Cancel(consumerTag, false)
+		wg.Wait()
+		return nil
+	case amqpErr := <-closed:
+		wg.Wait()
+		return fmt.Errorf("RabbitMQ connection closed: %v", amqpErr)
+	}
+}
+
+func (b *RabbitMQBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		return nil
+	}
+	return b.conn.Close()
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy computes exponential backoff delays. The delay for attempt n is
+// BaseDelay * 2^n capped at MaxDelay, of which the Jitter fraction (0..1) is
+// randomised so that jobs failing together do not retry together.
+type RetryPolicy struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Jitter    float64
+}
+
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if attempt < 0 {
+		attempt = 0
+	}
+
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	delay = delay*(1-jitter) + rand.Float64()*delay*jitter
+
+	return time.Duration(delay)
+}
+
+// retryBuckets are the fixed delays the brokers implement retries with,
+// shortest first. A broker keeps one retry queue or topic per bucket, so
+// every message in it waits the same time and none can hold up a message
+// behind it that is due earlier.
+var retryBuckets = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+}
+
+// retryBucket returns the longest retry bucket that does not exceed delay, or
+// 0 when delay is shorter than every bucket.
+func retryBucket(delay time.Duration) time.Duration {
+	var bucket time.Duration
+	for _, candidate := range retryBuckets {
+		if candidate > delay {
+			break
+		}
+		bucket = candidate
+	}
+	return bucket
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBucket(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  time.Duration
+	}{
+		{0, 0},
+		{500 * time.Millisecond, 0},
+		{time.Second, time.Second},
+		{4 * time.Second, time.Second},
+		{5 * time.Second, 5 * time.Second},
+		{90 * time.Second, time.Minute},
+		{10 * time.Minute, 5 * time.Minute},
+		{24 * time.Hour, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := retryBucket(tt.delay); got != tt.want {
+			t.Errorf("retryBucket(%v) = %v, want %v", tt.delay, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/models"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShadowService mirrors completed primary predictions to candidate models in
+// the background. Shadow results never reach the client; they are stored in
+// shadow_predictions next to the primary prediction so the two can be
+// compared before a candidate is promoted.
+type ShadowService struct {
+	db        *database.DB
+	mlClient  *MLClient
+	endpoints []config.MLEndpoint
+	timeout   time.Duration
+	slots     chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewShadowService creates a shadow service calling endpoints through
+// mlClient, with at most concurrency shadow calls in flight. Images beyond
+// that are not mirrored rather than queued, so shadow traffic can never slow
+// the primary path down.
+func NewShadowService(db *database.DB, mlClient *MLClient, endpoints []config.MLEndpoint, concurrency int, timeout time.Duration) *ShadowService {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ShadowService{
+		db:        db,
+		mlClient:  mlClient,
+		endpoints: endpoints,
+		timeout:   timeout,
+		slots:     make(chan struct{}, concurrency),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Mirror sends the image of a completed primary prediction to every shadow
+// endpoint that samples it. It returns immediately.
+func (s *ShadowService) Mirror(prediction *models.Prediction, imagePath string) {
+	if prediction.Status != "completed" {
+		return
+	}
+
+	for _, endpoint := range s.endpoints {
+		if !shadowSampled(prediction.ImageID, endpoint) {
+			continue
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			log.Printf("Shadow %s: skipped prediction %s, all slots busy", endpoint.Name, prediction.ID)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(endpoint config.MLEndpoint) {
+			defer s.wg.Done()
+			defer func() { <-s.slots }()
+
+			if err := s.run(endpoint, prediction, imagePath); err != nil {
+				log.Printf("Shadow %s: prediction %s: %v", endpoint.Name, prediction.ID, err)
+			}
+		}(endpoint)
+	}
+}
+
+// Close aborts shadow calls in flight and waits for them to return.
+func (s *ShadowService) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *ShadowService) run(endpoint config.MLEndpoint, prediction *models.Prediction, imagePath string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+	defer cancel()
+
+	shadow := &models.ShadowPrediction{
+		ID:           uuid.New(),
+		PredictionID: prediction.ID,
+		ImageID:      prediction.ImageID,
+		MLVariant:    endpoint.Name,
+		Status:       "failed",
+		CreatedAt:    time.Now(),
+	}
+
+	result, err := s.mlClient.PredictWithEndpoint(ctx, endpoint.Name, imagePath)
+	if s.ctx.Err() != nil {
+		return nil
+	}
+
+	switch {
+	case err != nil:
+		shadow.MLModelVersion = endpoint.ModelVersion
+		shadow.ErrorMessage = err.Error()
+	case !result.Success:
+		shadow.MLModelVersion = result.ModelVersion
+		shadow.ErrorMessage = result.Error
+	default:
+		shadow.MLModelVersion = result.ModelVersion
+		shadow.CleanlinessStatus = result.Cleanliness.Status
+		shadow.CleanlinessConfidence = result.Cleanliness.Confidence
+		shadow.IntegrityStatus = result.Integrity.Status
+		shadow.IntegrityConfidence = result.Integrity.Confidence
+		shadow.ProcessingTimeMs = result.ProcessingTime
+		shadow.Status = "completed"
+	}
+
+	return s.save(shadow)
+}
+
+func (s *ShadowService) save(shadow *models.ShadowPrediction) error {
+	query := `
+		INSERT INTO shadow_predictions (
+			id, prediction_id, image_id, ml_variant, ml_model_version,
+			cleanliness_status, cleanliness_confidence, integrity_status, integrity_confidence,
+			processing_time_ms, status, error_message, created_at
+		)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''), $9, $10, $11, NULLIF($12, ''), $13)
+	`
+
+	_, err := s.db.Exec(query,
+		shadow.ID,
+		shadow.PredictionID,
+		shadow.ImageID,
+		shadow.MLVariant,
+		shadow.MLModelVersion,
+		shadow.CleanlinessStatus,
+		shadow.CleanlinessConfidence,
+		shadow.IntegrityStatus,
+		shadow.IntegrityConfidence,
+		shadow.ProcessingTimeMs,
+		shadow.Status,
+		shadow.ErrorMessage,
+		shadow.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save shadow prediction: %w", err)
+	}
+
+	return nil
+}
+
+// AgreementReport compares every shadow model with the primary predictions
+// it mirrored over the last hours.
+func (s *ShadowService) AgreementReport(ctx context.Context, hours int) (*models.ShadowReport, error) {
+	query := `
+		SELECT
+			s.ml_variant,
+			COALESCE(s.ml_model_version, '') as ml_model_version,
+			COUNT(*) as total,
+			COUNT(CASE WHEN s.status = 'completed' THEN 1 END) as completed,
+			COUNT(CASE WHEN s.status = 'failed' THEN 1 END) as failed,
+			AVG(CASE WHEN s.status = 'completed' THEN
+				CASE WHEN s.cleanliness_status = p.cleanliness_status THEN 1.0 ELSE 0.0 END
+			END) as cleanliness_match_rate,
+			AVG(CASE WHEN s.status = 'completed' THEN
+				CASE WHEN s.integrity_status = p.integrity_status THEN 1.0 ELSE 0.0 END
+			END) as integrity_match_rate,
+			AVG(CASE WHEN s.status = 'completed' THEN
+				CASE WHEN s.cleanliness_status = p.cleanliness_status AND s.integrity_status = p.integrity_status THEN 1.0 ELSE 0.0 END
+			END) as full_match_rate,
+			AVG(CASE WHEN s.status = 'completed' THEN s.cleanliness_confidence - p.cleanliness_confidence END) as avg_cleanliness_confidence_delta,
+			AVG(CASE WHEN s.status = 'completed' THEN s.integrity_confidence - p.integrity_confidence END) as avg_integrity_confidence_delta,
+			AVG(CASE WHEN s.status = 'completed' AND s.processing_time_ms > 0 THEN s.processing_time_ms END) as avg_processing_time_ms,
+			AVG(CASE WHEN s.status = 'completed' AND p.processing_time_ms > 0 THEN p.processing_time_ms END) as avg_primary_processing_time_ms
+		FROM shadow_predictions s
+		JOIN predictions p ON p.id = s.prediction_id
+		WHERE s.created_at > NOW() - $1 * INTERVAL '1 hour'
+		GROUP BY s.ml_variant, COALESCE(s.ml_model_version, '')
+		ORDER BY s.ml_variant, ml_model_version
+	`
+
+	report := &models.ShadowReport{
+		Hours:    hours,
+		Variants: []models.ShadowAgreement{},
+	}
+
+	err := s.db.SelectContext(ctx, &report.Variants, query, hours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shadow agreement report: %w", err)
+	}
+
+	return report, nil
+}
+
+// shadowSampled decides whether an image is mirrored to endpoint. Weight is a
+// percentage, and the decision is a hash of the image ID and endpoint name so
+// that re-predictions of an image are sampled consistently.
+func shadowSampled(imageID uuid.UUID, endpoint config.MLEndpoint) bool {
+	if endpoint.Weight >= 100 {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write(imageID[:])
+	hash.Write([]byte(endpoint.Name))
+	return int(hash.Sum32()%100) < endpoint.Weight
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/database"
+	"car-status-backend/internal/mlfake"
+	"car-status-backend/internal/models"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newShadowService mirrors to one fake ML service per endpoint, which all
+// answer with script. db may be nil for tests that never save a result.
+func newShadowService(t *testing.T, db *database.DB, script mlfake.Script, concurrency int, endpoints ...config.MLEndpoint) (*ShadowService, []*mlfake.Server) {
+	t.Helper()
+
+	var fakes []*mlfake.Server
+	for i := range endpoints {
+		fake, server := mlfake.Start(script)
+		t.Cleanup(server.Close)
+		endpoints[i].URL = server.URL
+		fakes = append(fakes, fake)
+	}
+
+	client := NewMLClient(endpoints, 5*time.Second, "", MLTransportPath, 0, RetryPolicy{}, HedgePolicy{}, 5, time.Minute, nil)
+	t.Cleanup(func() { client.Close() })
+
+	return NewShadowService(db, client, endpoints, concurrency, 5*time.Second), fakes
+}
+
+func TestShadowSampledByWeight(t *testing.T) {
+	endpoint := config.MLEndpoint{Name: "candidate", Weight: 25}
+
+	const images = 20000
+	sampled := 0
+	for i := 0; i < images; i++ {
+		imageID := uuid.New()
+		if shadowSampled(imageID, endpoint) {
+			sampled++
+		}
+		if shadowSampled(imageID, endpoint) != shadowSampled(imageID, endpoint) {
+			t.Fatalf("image %s sampled inconsistently", imageID)
+		}
+		if !shadowSampled(imageID, config.MLEndpoint{Name: "all", Weight: 100}) {
+			t.Fatal("weight 100 skipped an image")
+		}
+		if shadowSampled(imageID, config.MLEndpoint{Name: "none", Weight: 0}) {
+			t.Fatal("weight 0 sampled an image")
+		}
+	}
+
+	if share := float64(sampled) / images; math.Abs(share-0.25) > 0.02 {
+		t.Errorf("sampled %.1f%% of images, want about 25%%", share*100)
+	}
+}
+
+func TestShadowServiceSkipsImagesWhenSlotsAreBusy(t *testing.T) {
+	// Shadow calls hang until Close, so nothing is ever saved.
+	script := mlfake.Script{Default: mlfake.Response{Delay: mlfake.Duration(time.Minute)}}
+	shadow, fakes := newShadowService(t, nil, script, 1,
+		config.MLEndpoint{Name: "first", Weight: 100},
+		config.MLEndpoint{Name: "second", Weight: 100},
+	)
+	defer shadow.Close()
+
+	// Failed primaries are not worth comparing.
+	shadow.Mirror(&models.Prediction{ID: uuid.New(), ImageID: uuid.New(), Status: "failed"}, "/uploads/car.jpg")
+
+	shadow.Mirror(&models.Prediction{ID: uuid.New(), ImageID: uuid.New(), Status: "completed"}, "/uploads/car.jpg")
+	time.Sleep(100 * time.Millisecond)
+
+	// The only slot went to the first endpoint; the second is skipped
+	// rather than queued.
+	if got := len(fakes[0].Requests()); got != 1 {
+		t.Errorf("first shadow got %d requests, want 1", got)
+	}
+	if got := len(fakes[1].Requests()); got != 0 {
+		t.Errorf("second shadow got %d requests with no free slot, want 0", got)
+	}
+
+	// Mirror never waits for a slot.
+	started := time.Now()
+	shadow.Mirror(&models.Prediction{ID: uuid.New(), ImageID: uuid.New(), Status: "completed"}, "/uploads/car.jpg")
+	if waited := time.Since(started); waited > 50*time.Millisecond {
+		t.Errorf("Mirror blocked for %v with all slots busy", waited)
+	}
+}
+
+func TestShadowServiceReportsAgreementWithPrimary(t *testing.T) {
+	db := testDB(t)
+	predictions := NewPredictionService(db)
+
+	// The candidate calls every car dirty and intact with confidence 0.8.
+	variant := "candidate-" + uuid.NewString()
+	script := mlfake.Script{Default: mlfake.Response{
+		Cleanliness: "dirty", CleanlinessConfidence: 0.8,
+		Integrity: "intact", IntegrityConfidence: 0.8,
+		ModelVersion: "2.0", ProcessingTimeMs: 50,
+	}}
+	shadow, _ := newShadowService(t, db, script, 4, config.MLEndpoint{Name: variant, Weight: 100})
+	defer shadow.Close()
+
+	primaries := []*models.Prediction{
+		storePrediction(t, db, predictions, "", mlResult("default", "1.0", "dirty", 0.9)),
+		storePrediction(t, db, predictions, "", mlResult("default", "1.0", "clean", 0.7)),
+	}
+	for _, primary := range primaries {
+		shadow.Mirror(primary, "/uploads/car.jpg")
+	}
+
+	var agreement *models.ShadowAgreement
+	deadline := time.Now().Add(5 * time.Second)
+	for agreement == nil || agreement.Total < len(primaries) {
+		if time.Now().After(deadline) {
+			t.Fatalf("shadow results = %+v, want %d", agreement, len(primaries))
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		report, err := shadow.AgreementReport(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("AgreementReport: %v", err)
+		}
+		for i := range report.Variants {
+			if report.Variants[i].Variant == variant {
+				agreement = &report.Variants[i]
+			}
+		}
+	}
+
+	if agreement.ModelVersion != "2.0" || agreement.Completed != 2 || agreement.Failed != 0 {
+		t.Errorf("agreement = %+v, want 2 completed on 2.0", agreement)
+	}
+	rates := map[string]*float64{
+		"cleanliness match": agreement.CleanlinessMatchRate,
+		"integrity match":   agreement.IntegrityMatchRate,
+		"full match":        agreement.FullMatchRate,
+		"cleanliness delta": agreement.AvgCleanlinessConfidenceDelta,
+	}
+	want := map[string]float64{
+		"cleanliness match": 0.5,
+		"integrity match":   1,
+		"full match":        0.5,
+		"cleanliness delta": 0, // (0.8-0.9 + 0.8-0.7) / 2
+	}
+	for name, rate := range rates {
+		if rate == nil || math.Abs(*rate-want[name]) > 0.001 {
+			t.Errorf("%s = %v, want %v", name, rate, want[name])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"car-status-backend/internal/models"
+	"car-status-backend/internal/services"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// batchWindow is how long the batcher waits for more workers to join a batch
+// after the first request arrived.
+const batchWindow = 20 * time.Millisecond
+
+type batchRequest struct {
+	item   services.MLBatchItem
+	result chan services.MLBatchResult
+}
+
+// mlBatcher gathers the ML calls that workers make at about the same time
+// into one MLClient.PredictBatch call, so over gRPC they share a single
+// stream on the persistent connection instead of one RPC each. A batch is
+// sent once it holds maxSize images or batchWindow has passed.
+type mlBatcher struct {
+	mlClient *services.MLClient
+	maxSize  int
+	requests chan batchRequest
+	wg       sync.WaitGroup
+}
+
+func newMLBatcher(mlClient *services.MLClient, maxSize int) *mlBatcher {
+	return &mlBatcher{
+		mlClient: mlClient,
+		maxSize:  maxSize,
+		requests: make(chan batchRequest),
+	}
+}
+
+// run forms and sends batches until ctx is cancelled, then waits for the
+// batches in flight, which ctx aborts.
+func (b *mlBatcher) run(ctx context.Context) {
+	defer b.wg.Wait()
+
+	for {
+		var first batchRequest
+		select {
+		case <-ctx.Done():
+			return
+		case first = <-b.requests:
+		}
+
+		batch := []batchRequest{first}
+		timer := time.NewTimer(batchWindow)
+	collect:
+		for len(batch) < b.maxSize {
+			select {
+			case req := <-b.requests:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			case <-ctx.Done():
+				break collect
+			}
+		}
+		timer.Stop()
+
+		b.wg.Add(1)
+		go b.send(ctx, batch)
+	}
+}
+
+func (b *mlBatcher) send(ctx context.Context, batch []batchRequest) {
+	defer b.wg.Done()
+
+	items := make([]services.MLBatchItem, len(batch))
+	for i, req := range batch {
+		items[i] = req.item
+	}
+
+	for i, result := range b.mlClient.PredictBatch(ctx, items) {
+		batch[i].result <- result
+	}
+}
+
+// predict makes one worker's ML call as part of a batch. It returns early
+// with ctx's error when ctx ends first, e.g. because the job was cancelled;
+// the answer of the batch is then dropped.
+func (b *mlBatcher) predict(ctx context.Context, imageID uuid.UUID, imagePath string) (*models.MLPredictionResponse, error) {
+	req := batchRequest{
+		item:   services.MLBatchItem{ImageID: imageID, ImagePath: imagePath},
+		result: make(chan services.MLBatchResult, 1),
+	}
+
+	select {
+	case b.requests <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case result := <-req.result:
+		return result.Result, result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,372 @@
+package worker
+
+import (
+	"car-status-backend/internal/models"
+	"car-status-backend/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// jobWaiter is implemented by queues that can wake idle workers as soon as a
+// job is published, such as the DB queue through LISTEN/NOTIFY.
+type jobWaiter interface {
+	WaitForJob(ctx context.Context, timeout time.Duration)
+}
+
+// imageStore and predictionStore are the parts of ImageService and
+// PredictionService the pool uses, so the pool can run without Postgres.
+type imageStore interface {
+	GetImageByID(ctx context.Context, id uuid.UUID) (*models.CarImage, error)
+}
+
+type predictionStore interface {
+	CreatePrediction(ctx context.Context, imageID uuid.UUID, mlResult *models.MLPredictionResponse) (*models.Prediction, error)
+}
+
+type Options struct {
+	PoolSize      int
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	ReapInterval  time.Duration
+}
+
+// Pool drains the prediction queue with a fixed number of workers. It only
+// depends on services.Queue, so the same loop runs against the database,
+// RabbitMQ, Kafka or the in-memory backend. Every claimed job is leased to its
+// worker and the lease is renewed while the ML call is in flight; jobs whose
+// lease runs out (crashed worker, killed pod) are returned to the queue by the
+// reaper.
+type Pool struct {
+	queue             services.Queue
+	imageService      imageStore
+	predictionService predictionStore
+	mlClient          *services.MLClient
+	shadowService     *services.ShadowService
+	batcher           *mlBatcher
+	opts              Options
+	instanceID        string
+	wg                sync.WaitGroup
+}
+
+func NewPool(
+	queue services.Queue,
+	imageService imageStore,
+	predictionService predictionStore,
+	mlClient *services.MLClient,
+	shadowService *services.ShadowService,
+	opts Options,
+) *Pool {
+	if opts.PoolSize < 1 {
+		opts.PoolSize = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = time.Minute
+	}
+	if opts.ReapInterval <= 0 {
+		opts.ReapInterval = 30 * time.Second
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	pool := &Pool{
+		queue:             queue,
+		imageService:      imageService,
+		predictionService: predictionService,
+		mlClient:          mlClient,
+		shadowService:     shadowService,
+		opts:              opts,
+		instanceID:        fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+	if mlClient.StreamsBatches() && opts.PoolSize > 1 {
+		pool.batcher = newMLBatcher(mlClient, opts.PoolSize)
+	}
+
+	return pool
+}
+
+func (p *Pool) Start(ctx context.Context) {
+	if p.batcher != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.batcher.run(ctx)
+		}()
+	}
+
+	for i := 0; i < p.opts.PoolSize; i++ {
+		p.wg.Add(1)
+		go p.run(ctx, i+1)
+	}
+
+	p.wg.Add(1)
+	go p.reap(ctx)
+
+	log.Printf("Worker pool %s started with %d workers on the %s queue", p.instanceID, p.opts.PoolSize, p.queue.Type())
+}
+
+// Wait blocks until every worker has returned after the context passed to
+// Start is cancelled. ML calls still in flight are aborted and their jobs
+// rescheduled.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+	log.Println("Worker pool stopped")
+}
+
+func (p *Pool) run(ctx context.Context, workerID int) {
+	defer p.wg.Done()
+
+	for ctx.Err() == nil {
+		job, err := p.queue.Claim(ctx, p.workerName(workerID), p.opts.LeaseDuration)
+		if err != nil {
+			log.Printf("Worker %d: %v", workerID, err)
+			sleep(ctx, p.opts.PollInterval)
+			continue
+		}
+
+		if job == nil {
+			p.idle(ctx)
+			continue
+		}
+
+		p.process(ctx, workerID, job)
+	}
+}
+
+// process runs one job. The ML call is aborted when the pool shuts down or
+// cancellation of the job is requested; a job interrupted by shutdown is
+// rescheduled.
+func (p *Pool) process(ctx context.Context, workerID int, job *models.PredictionJob) {
+	cancelled, stopHeartbeat := p.heartbeat(workerID, job)
+	defer stopHeartbeat()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-cancelled:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	image, err := p.imageService.GetImageByID(ctx, job.ImageID)
+	if err != nil && ctx.Err() != nil {
+		p.nackJob(workerID, job, "worker stopped before prediction", true)
+		return
+	}
+	if errors.Is(err, services.ErrImageNotFound) {
+		p.nackJob(workerID, job, fmt.Sprintf("image %s not found", job.ImageID), false)
+		return
+	}
+	if err != nil {
+		// Any other lookup failure, such as a database outage, says
+		// nothing about the image and is retried.
+		p.nackJob(workerID, job, err.Error(), true)
+		return
+	}
+
+	if p.stopIfCancelled(workerID, job, cancelled) {
+		return
+	}
+
+	mlResult, err := p.predict(ctx, image)
+	if p.stopIfCancelled(workerID, job, cancelled) {
+		return
+	}
+	if ctx.Err() != nil {
+		p.nackJob(workerID, job, "worker stopped during prediction", true)
+		return
+	}
+
+	if mlErr := services.ClassifyMLFailure(mlResult, err); mlErr != nil {
+		if mlErr.Retryable && job.RetryCount < job.MaxRetries {
+			p.nackJob(workerID, job, mlErr.Error(), true)
+			return
+		}
+
+		// Record the final outcome so clients polling the job see a failed
+		// prediction rather than nothing.
+		if mlResult == nil {
+			mlResult = &models.MLPredictionResponse{
+				Error:   mlErr.Error(),
+				Variant: p.mlClient.VariantFor(job.ImageID),
+			}
+		}
+		prediction, err := p.predictionService.CreatePrediction(ctx, job.ImageID, mlResult)
+		if err != nil {
+			log.Printf("Worker %d: job %s: %v", workerID, job.ID, err)
+		} else {
+			p.linkPrediction(workerID, job, prediction.ID)
+		}
+
+		p.nackJob(workerID, job, mlErr.Error(), false)
+		return
+	}
+
+	prediction, err := p.predictionService.CreatePrediction(ctx, job.ImageID, mlResult)
+	if err != nil {
+		p.nackJob(workerID, job, err.Error(), true)
+		return
+	}
+	if p.shadowService != nil {
+		p.shadowService.Mirror(prediction, image.FilePath)
+	}
+
+	if err := p.queue.Ack(job.ID, p.workerName(workerID), prediction.ID); err != nil {
+		log.Printf("Worker %d: job %s: %v", workerID, job.ID, err)
+		return
+	}
+
+	log.Printf("Worker %d: job %s completed for image %s", workerID, job.ID, job.ImageID)
+}
+
+// predict makes the ML call for a job, batched with the calls of other
+// workers when the ML client streams batches.
+func (p *Pool) predict(ctx context.Context, image *models.CarImage) (*models.MLPredictionResponse, error) {
+	if p.batcher != nil {
+		return p.batcher.predict(ctx, image.ID, image.FilePath)
+	}
+	return p.mlClient.PredictCarStatus(ctx, image.ID, image.FilePath)
+}
+
+func (p *Pool) linkPrediction(workerID int, job *models.PredictionJob, predictionID uuid.UUID) {
+	if err := p.queue.SetPrediction(job.ID, predictionID); err != nil {
+		log.Printf("Worker %d: job %s: %v", workerID, job.ID, err)
+	}
+}
+
+func (p *Pool) nackJob(workerID int, job *models.PredictionJob, reason string, retryable bool) {
+	status, err := p.queue.Nack(job, reason, retryable)
+	if err != nil {
+		log.Printf("Worker %d: job %s: %v", workerID, job.ID, err)
+		return
+	}
+
+	if status == models.JobStatusDeadLetter {
+		log.Printf("Worker %d: job %s dead-lettered after %d retries: %s", workerID, job.ID, job.RetryCount, reason)
+		return
+	}
+
+	log.Printf("Worker %d: job %s rescheduled (attempt %d/%d): %s", workerID, job.ID, job.RetryCount+1, job.MaxRetries, reason)
+}
+
+// heartbeat renews the job lease every third of the lease duration until the
+// returned stop function is called. The returned channel is closed when the
+// queue reports that cancellation of the job was requested.
+func (p *Pool) heartbeat(workerID int, job *models.PredictionJob) (<-chan struct{}, func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(p.opts.LeaseDuration / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := p.queue.RenewLease(job.ID, p.workerName(workerID), p.opts.LeaseDuration)
+				if errors.Is(err, services.ErrJobCancelled) {
+					close(cancelled)
+					return
+				}
+				if err != nil {
+					log.Printf("Worker %d: job %s: %v", workerID, job.ID, err)
+				}
+			}
+		}
+	}()
+
+	return cancelled, func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// stopIfCancelled checks for a cancellation request between processing steps
+// and, if there is one, marks the job cancelled. A request that arrived since
+// the last heartbeat is picked up by renewing the lease once more.
+func (p *Pool) stopIfCancelled(workerID int, job *models.PredictionJob, cancelled <-chan struct{}) bool {
+	select {
+	case <-cancelled:
+	default:
+		err := p.queue.RenewLease(job.ID, p.workerName(workerID), p.opts.LeaseDuration)
+		if !errors.Is(err, services.ErrJobCancelled) {
+			return false
+		}
+	}
+
+	if err := p.queue.AckCancel(job.ID, p.workerName(workerID)); err != nil {
+		log.Printf("Worker %d: job %s: %v", workerID, job.ID, err)
+		return true
+	}
+
+	log.Printf("Worker %d: job %s cancelled", workerID, job.ID)
+	return true
+}
+
+func (p *Pool) reap(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.opts.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			requeued, deadLettered, err := p.queue.ReapExpired()
+			if err != nil {
+				log.Printf("Job reaper: %v", err)
+				continue
+			}
+
+			if requeued > 0 || deadLettered > 0 {
+				log.Printf("Job reaper: %d expired jobs requeued, %d dead-lettered", requeued, deadLettered)
+			}
+		}
+	}
+}
+
+// idle waits for the next job. Queues that can announce new jobs wake the
+// worker early; PollInterval is then only the fallback for scheduled retries.
+func (p *Pool) idle(ctx context.Context) {
+	if waiter, ok := p.queue.(jobWaiter); ok {
+		waiter.WaitForJob(ctx, p.opts.PollInterval)
+		return
+	}
+
+	sleep(ctx, p.opts.PollInterval)
+}
+
+func (p *Pool) workerName(workerID int) string {
+	return fmt.Sprintf("%s/%d", p.instanceID, workerID)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
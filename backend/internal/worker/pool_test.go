@@ -0,0 +1,304 @@
+package worker
+
+import (
+	"car-status-backend/internal/config"
+	"car-status-backend/internal/mlfake"
+	"car-status-backend/internal/models"
+	"car-status-backend/internal/services"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeImages and fakePredictions stand in for the Postgres-backed services.
+type fakeImages struct {
+	mu     sync.Mutex
+	images map[uuid.UUID]*models.CarImage
+	// failures is how many lookups fail with a database error before the
+	// images are served again.
+	failures int
+}
+
+func (f *fakeImages) GetImageByID(ctx context.Context, id uuid.UUID) (*models.CarImage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("failed to get image: connection refused")
+	}
+	image, ok := f.images[id]
+	if !ok {
+		return nil, services.ErrImageNotFound
+	}
+	return image, nil
+}
+
+type fakePredictions struct {
+	mu          sync.Mutex
+	predictions []*models.Prediction
+}
+
+func (f *fakePredictions) CreatePrediction(ctx context.Context, imageID uuid.UUID, mlResult *models.MLPredictionResponse) (*models.Prediction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := "completed"
+	if !mlResult.Success {
+		status = "failed"
+	}
+	prediction := &models.Prediction{
+		ID:                uuid.New(),
+		ImageID:           imageID,
+		CleanlinessStatus: mlResult.Cleanliness.Status,
+		IntegrityStatus:   mlResult.Integrity.Status,
+		Status:            status,
+		ErrorMessage:      mlResult.Error,
+	}
+	f.predictions = append(f.predictions, prediction)
+	return prediction, nil
+}
+
+func (f *fakePredictions) get(id uuid.UUID) *models.Prediction {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, prediction := range f.predictions {
+		if prediction.ID == id {
+			return prediction
+		}
+	}
+	return nil
+}
+
+type poolHarness struct {
+	queue       *services.MemoryQueue
+	ml          *mlfake.Server
+	images      *fakeImages
+	predictions *fakePredictions
+	pool        *Pool
+}
+
+// newPoolHarness wires a pool to a memory queue and a fake ML service over
+// HTTP. The pool is started by start, so tests can set up jobs first.
+func newPoolHarness(t *testing.T, script mlfake.Script, maxRetries int, retryPolicy services.RetryPolicy) *poolHarness {
+	t.Helper()
+
+	ml, server := mlfake.Start(script)
+	t.Cleanup(server.Close)
+
+	mlClient := services.NewMLClient(
+		[]config.MLEndpoint{{Name: "default", URL: server.URL, Weight: 100}},
+		5*time.Second, "", services.MLTransportPath, 0, services.RetryPolicy{},
+		services.HedgePolicy{}, 100, time.Minute, nil,
+	)
+
+	h := &poolHarness{
+		queue:       services.NewMemoryQueue(maxRetries, retryPolicy),
+		ml:          ml,
+		images:      &fakeImages{images: map[uuid.UUID]*models.CarImage{}},
+		predictions: &fakePredictions{},
+	}
+	h.pool = NewPool(h.queue, h.images, h.predictions, mlClient, nil, Options{
+		PoolSize:      2,
+		PollInterval:  10 * time.Millisecond,
+		LeaseDuration: time.Second,
+		ReapInterval:  20 * time.Millisecond,
+	})
+	return h
+}
+
+func (h *poolHarness) start(t *testing.T) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.pool.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		h.pool.Wait()
+	})
+}
+
+// publish stores an image file and queues a job for it.
+func (h *poolHarness) publish(t *testing.T) *models.PredictionJob {
+	t.Helper()
+
+	image := &models.CarImage{ID: uuid.New()}
+	image.FilePath = filepath.Join(t.TempDir(), image.ID.String()+".jpg")
+	if err := os.WriteFile(image.FilePath, []byte("jpeg"), 0o644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+
+	h.images.mu.Lock()
+	h.images.images[image.ID] = image
+	h.images.mu.Unlock()
+
+	job, err := h.queue.Publish(image.ID, image.FilePath, models.JobOptions{})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return job
+}
+
+// waitForStatus polls the queue until the job reaches status.
+func (h *poolHarness) waitForStatus(t *testing.T, jobID uuid.UUID, status models.JobStatus) *models.PredictionJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := h.queue.Get(jobID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if job.Status == string(status) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", jobID, job.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolBacksOffAfterRetryableFailure(t *testing.T) {
+	const backoff = 200 * time.Millisecond
+
+	h := newPoolHarness(t, mlfake.Script{}, 3, services.RetryPolicy{BaseDelay: backoff})
+	h.ml.Enqueue(mlfake.Response{StatusCode: 503, Error: "model is loading"})
+	h.start(t)
+
+	published := h.publish(t)
+	job := h.waitForStatus(t, published.ID, models.JobStatusCompleted)
+
+	if job.RetryCount != 1 {
+		t.Errorf("RetryCount = %d, want 1", job.RetryCount)
+	}
+
+	requests := h.ml.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("ML service got %d requests, want 2", len(requests))
+	}
+	if gap := requests[1].ReceivedAt.Sub(requests[0].ReceivedAt); gap < backoff {
+		t.Errorf("retry came %v after the failure, want at least %v", gap, backoff)
+	}
+}
+
+func TestPoolDeadLettersWhenRetriesAreExhausted(t *testing.T) {
+	script := mlfake.Script{Default: mlfake.Response{StatusCode: 503, Error: "model is loading"}}
+	h := newPoolHarness(t, script, 2, services.RetryPolicy{BaseDelay: time.Millisecond})
+	h.start(t)
+
+	published := h.publish(t)
+	job := h.waitForStatus(t, published.ID, models.JobStatusDeadLetter)
+
+	if job.RetryCount != 2 {
+		t.Errorf("RetryCount = %d, want 2", job.RetryCount)
+	}
+	if got := len(h.ml.Requests()); got != 3 {
+		t.Errorf("ML service got %d requests, want 3", got)
+	}
+	// Clients polling the job see the failure as a prediction.
+	if job.PredictionID == nil {
+		t.Fatal("dead-lettered job has no failed prediction")
+	}
+	if prediction := h.predictions.get(*job.PredictionID); prediction == nil || prediction.Status != "failed" {
+		t.Errorf("prediction = %+v, want a failed prediction", prediction)
+	}
+}
+
+func TestPoolDeadLettersPermanentFailureRightAway(t *testing.T) {
+	script := mlfake.Script{Default: mlfake.Response{StatusCode: 422, Error: "not a car"}}
+	h := newPoolHarness(t, script, 3, services.RetryPolicy{BaseDelay: time.Millisecond})
+	h.start(t)
+
+	published := h.publish(t)
+	job := h.waitForStatus(t, published.ID, models.JobStatusDeadLetter)
+
+	if job.RetryCount != 0 {
+		t.Errorf("RetryCount = %d, want 0", job.RetryCount)
+	}
+	if got := len(h.ml.Requests()); got != 1 {
+		t.Errorf("ML service got %d requests, want 1", got)
+	}
+}
+
+func TestPoolReapsJobOfCrashedWorker(t *testing.T) {
+	h := newPoolHarness(t, mlfake.Script{}, 3, services.RetryPolicy{})
+	published := h.publish(t)
+
+	// A worker that claims the job and dies without reporting back.
+	crashed, err := h.queue.Claim(context.Background(), "crashed/1", 50*time.Millisecond)
+	if err != nil || crashed == nil {
+		t.Fatalf("Claim = %v, %v", crashed, err)
+	}
+
+	h.start(t)
+	job := h.waitForStatus(t, published.ID, models.JobStatusCompleted)
+
+	if job.RetryCount != 1 {
+		t.Errorf("RetryCount = %d, want 1 after the lease expired", job.RetryCount)
+	}
+	// The crashed worker coming back must not overwrite the result.
+	if err := h.queue.Ack(crashed.ID, "crashed/1", uuid.New()); !errors.Is(err, services.ErrJobLeaseLost) {
+		t.Errorf("late Ack = %v, want ErrJobLeaseLost", err)
+	}
+	if stored, _ := h.queue.Get(published.ID); *stored.PredictionID != *job.PredictionID {
+		t.Errorf("late Ack replaced prediction %s with %s", *job.PredictionID, *stored.PredictionID)
+	}
+}
+
+func TestPoolCompletesJob(t *testing.T) {
+	h := newPoolHarness(t, mlfake.Script{}, 3, services.RetryPolicy{})
+	h.start(t)
+
+	published := h.publish(t)
+	job := h.waitForStatus(t, published.ID, models.JobStatusCompleted)
+
+	if job.PredictionID == nil {
+		t.Fatal("completed job has no prediction")
+	}
+	prediction := h.predictions.get(*job.PredictionID)
+	if prediction == nil || prediction.ImageID != published.ImageID || prediction.Status != "completed" {
+		t.Fatalf("prediction = %+v, want a completed prediction for image %s", prediction, published.ImageID)
+	}
+	if job.RetryCount != 0 || job.LockedBy != "" {
+		t.Errorf("RetryCount = %d, LockedBy = %q; want a first-try job without a lease", job.RetryCount, job.LockedBy)
+	}
+}
+
+func TestPoolDeadLettersJobOfMissingImage(t *testing.T) {
+	h := newPoolHarness(t, mlfake.Script{}, 3, services.RetryPolicy{BaseDelay: time.Millisecond})
+	h.start(t)
+
+	published, err := h.queue.Publish(uuid.New(), "/uploads/deleted.jpg", models.JobOptions{})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	job := h.waitForStatus(t, published.ID, models.JobStatusDeadLetter)
+
+	if job.RetryCount != 0 {
+		t.Errorf("RetryCount = %d, want 0", job.RetryCount)
+	}
+	if got := len(h.ml.Requests()); got != 0 {
+		t.Errorf("ML service got %d requests, want none", got)
+	}
+}
+
+func TestPoolRetriesWhenImageLookupFails(t *testing.T) {
+	h := newPoolHarness(t, mlfake.Script{}, 3, services.RetryPolicy{BaseDelay: time.Millisecond})
+	h.images.failures = 2
+	h.start(t)
+
+	published := h.publish(t)
+	job := h.waitForStatus(t, published.ID, models.JobStatusCompleted)
+
+	if job.RetryCount != 2 {
+		t.Errorf("RetryCount = %d, want 2 after two failed lookups", job.RetryCount)
+	}
+}
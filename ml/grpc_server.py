@@ -0,0 +1,90 @@
+# gRPC сервер ML сервиса по контракту backend/proto/ml_service.proto.
+# Классы ml_service_pb2 / ml_service_pb2_grpc генерируются командой:
+#   python -m grpc_tools.protoc -I ../backend/proto --python_out=. --grpc_python_out=. ../backend/proto/ml_service.proto
+from concurrent import futures
+from io import BytesIO
+import os
+
+import grpc
+from fastapi import HTTPException
+from PIL import Image
+
+import ml_service_pb2
+import ml_service_pb2_grpc
+from main import run_prediction
+
+MAX_MESSAGE_SIZE = 16 * 1024 * 1024
+
+
+def predict_one(request):
+    kind = request.WhichOneof("image")
+    if kind is None:
+        return ml_service_pb2.PredictResponse(
+            request_id=request.request_id,
+            error="image_path или image_data обязателен",
+            status_code=400,
+        )
+
+    try:
+        if kind == "image_path":
+            if not os.path.isfile(request.image_path):
+                raise HTTPException(status_code=404, detail="Файл не найден по указанному пути")
+            image = request.image_path
+        else:
+            image = BytesIO(request.image_data)
+
+        try:
+            Image.open(image)
+        except Exception:
+            raise HTTPException(status_code=400, detail="Не удалось загрузить изображение")
+        if isinstance(image, BytesIO):
+            image.seek(0)
+
+        result = run_prediction(image)
+    except HTTPException as e:
+        return ml_service_pb2.PredictResponse(
+            request_id=request.request_id,
+            error=str(e.detail),
+            status_code=e.status_code,
+        )
+
+    return ml_service_pb2.PredictResponse(
+        request_id=request.request_id,
+        success=True,
+        cleanliness=ml_service_pb2.Label(**result["cleanliness"]),
+        integrity=ml_service_pb2.Label(**result["integrity"]),
+        processing_time_ms=result["processing_time_ms"],
+        model_version=result["model_version"],
+    )
+
+
+class MLService(ml_service_pb2_grpc.MLServiceServicer):
+    def Predict(self, request, context):
+        return predict_one(request)
+
+    def PredictStream(self, request_iterator, context):
+        for request in request_iterator:
+            yield predict_one(request)
+
+    def Health(self, request, context):
+        return ml_service_pb2.HealthResponse(status="ok", service="ml-service")
+
+
+def serve():
+    port = os.getenv("ML_GRPC_PORT", "50051")
+    server = grpc.server(
+        futures.ThreadPoolExecutor(max_workers=int(os.getenv("ML_GRPC_WORKERS", "4"))),
+        options=[
+            ("grpc.max_receive_message_length", MAX_MESSAGE_SIZE),
+            ("grpc.max_send_message_length", MAX_MESSAGE_SIZE),
+        ],
+    )
+    ml_service_pb2_grpc.add_MLServiceServicer_to_server(MLService(), server)
+    server.add_insecure_port(f"[::]:{port}")
+    server.start()
+    print(f"gRPC ML service listening on :{port}")
+    server.wait_for_termination()
+
+
+if __name__ == "__main__":
+    serve()
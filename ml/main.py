@@ -36,8 +36,22 @@ async def predict(request: PredictRequest):
     except Exception:
         raise HTTPException(status_code=400, detail="Не удалось загрузить изображение")
 
+    return run_prediction(request.image_path)
+
+@app.post("/api/predict/upload")
+async def predict_upload(file: UploadFile = File(...)):
+    data = await file.read()
+
+    try:
+        Image.open(BytesIO(data))
+    except Exception:
+        raise HTTPException(status_code=400, detail="Не удалось загрузить изображение")
+
+    return run_prediction(BytesIO(data))
+
+def run_prediction(image):
     try:
-        img_tensor = load_image(request.image_path)
+        img_tensor = load_image(image)
         prediction_array = clf.predict([img_tensor])
         prediction = encoder.inverse_transform(prediction_array)[0]
         print(f"DEBUG: Raw prediction = {prediction}")  # Debug output